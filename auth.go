@@ -2,16 +2,23 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/rs/zerolog/log"
 	"github.com/worldline-go/auth/models"
 	"github.com/worldline-go/auth/providers"
+	"github.com/worldline-go/auth/redirect"
+	"github.com/worldline-go/auth/request"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
 type InfProvider interface {
 	ClientConfig() (*clientcredentials.Config, error)
+	// ClientAuth returns the client authentication of the token endpoint.
+	ClientAuth() (*request.ClientAuth, error)
+	GetTokenEndpointAuthMethod() string
 
 	GetCertURL() string
 	GetTokenURL() string
@@ -24,8 +31,17 @@ type InfProvider interface {
 	GetClientSecretExternal() string
 	GetScopes() []string
 	GetIntrospectURL() string
+	// GetLogoutURL returns the end session endpoint.
 	GetLogoutURL() string
 	GetLogoutURLExternal() string
+	GetUserInfoURL() string
+	GetUserInfoURLExternal() string
+	// GetRevocationURL returns the token revocation endpoint, RFC 7009.
+	GetRevocationURL() string
+	// GetDeviceAuthURL returns the device authorization endpoint, RFC 8628.
+	GetDeviceAuthURL() string
+	// GetPARURL returns the pushed authorization request endpoint, RFC 9126.
+	GetPARURL() string
 }
 
 type InfProviderExtra interface {
@@ -33,9 +49,24 @@ type InfProviderExtra interface {
 	// JWTKeyFunc returns the JWT key used to verify the token.
 	JWTKeyFunc(opts ...OptionJWK) (models.InfKeyFuncParser, error)
 	IsNoop() bool
+	// HTTPClient returns the client with the provider's policy to use in calls to the provider.
+	HTTPClient() *http.Client
+	// AuthClient returns the request client with the provider's policy and DPoP.
+	AuthClient() *request.Auth
 	NewOauth2Shared(ctx context.Context) (*OAuth2Shared, error)
+	// NewOauth2SharedUser returns a shared token source of a logged-in user, see NewUserTokenSource.
+	NewOauth2SharedUser(ctx context.Context, opts ...OptionUserToken) (*OAuth2Shared, error)
 	RoundTripper(ctx context.Context, transport http.RoundTripper) (http.RoundTripper, error)
 	RoundTripperWrapper(cfg *clientcredentials.Config) func(ctx context.Context, transport http.RoundTripper) http.RoundTripper
+	// TokenExchangeFunc returns a function to exchange the forwarded tokens, see WithForwardExchange.
+	TokenExchangeFunc(cfg request.TokenExchangeConfig) TokenExchangeFunc
+	// SetRedirect fills the empty provider values of the redirect setting.
+	SetRedirect(setting *redirect.Setting)
+}
+
+type InfProviderValidate interface {
+	// Validate checks the configuration for the intended uses.
+	Validate(uses ...providers.Use) error
 }
 
 type Provider struct {
@@ -45,6 +76,16 @@ type Provider struct {
 	Active   string              `cfg:"active"`
 	Keycloak *providers.KeyCloak `cfg:"keycloak"`
 	Generic  *providers.Generic  `cfg:"generic"`
+	// Noop is the identity used by the noop provider when no token is sent.
+	Noop *providers.Noop `cfg:"noop"`
+	// Client is the timeout, retry and circuit breaker policy of the calls to the provider, optional.
+	//
+	// Used by token requests, JWKS fetch and introspection, share with HTTPClient of the active provider.
+	Client *request.ClientPolicy `cfg:"client"`
+	// DPoP binds the tokens of the client to a key with DPoP proofs, optional.
+	//
+	// Used by the token requests and resource requests of RoundTripper and HTTPClient of the active provider.
+	DPoP *request.DPoPConfig `cfg:"dpop"`
 }
 
 const (
@@ -54,25 +95,36 @@ const (
 )
 
 func (p *Provider) providerGen(providerKey string) InfProviderExtra {
+	var provider InfProvider
+
 	switch strings.ToLower(providerKey) {
 	case ProviderKeycloakKey:
-		return &ProviderExtra{
-			InfProvider: p.Keycloak,
-		}
+		provider = p.Keycloak
 	case ProviderGenericKey:
-		return &ProviderExtra{
-			InfProvider: p.Generic,
-		}
+		provider = p.Generic
 	case ProviderNoopKey:
-		return Noop{}
+		return Noop{Identity: p.Noop}
 	default:
 		return nil
 	}
+
+	// invalid key is reported by Validate, provider is usable without DPoP
+	dpop, err := p.DPoP.DPoP()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to set dpop, continue without dpop")
+	}
+
+	return &ProviderExtra{
+		InfProvider: provider,
+		client:      p.Client.HTTPClient(),
+		dpop:        dpop,
+		certClients: &certClientCache{},
+	}
 }
 
 // ActiveProvider returns the active provider or the first provider if none is active.
 //
-// Returns nil if no provider is configured.
+// Returns nil if no provider is configured or noop is refused by WithNoopGuard.
 func (p *Provider) ActiveProvider(opts ...OptionActiveProvider) (ret InfProviderExtra) {
 	o := optionsActiveProvider{
 		active: p.Active,
@@ -81,8 +133,14 @@ func (p *Provider) ActiveProvider(opts ...OptionActiveProvider) (ret InfProvider
 		opt(&o)
 	}
 
-	if o.noop {
-		return Noop{}
+	if o.noop || strings.EqualFold(o.active, ProviderNoopKey) {
+		if o.noopGuard && !NoopAllowed() {
+			log.Error().Msgf("noop provider refused, set %s=true to enable", NoopDevModeEnv)
+
+			return nil
+		}
+
+		return Noop{Identity: p.Noop}
 	}
 
 	if o.active != "" {
@@ -107,3 +165,63 @@ func (p Provider) SetActiveProvider(name string) *Provider {
 
 	return &p
 }
+
+// Validate checks the active provider's configuration for the intended uses.
+//
+// Noop provider is always valid. Use it after loading the config to fail fast.
+// Returns all problems at once as models.Errors.
+//
+//	if err := providerConfig.Validate(providers.UseResourceServer, providers.UseClientCredentials); err != nil {
+//		return fmt.Errorf("invalid auth config: %w", err)
+//	}
+func (p *Provider) Validate(uses ...providers.Use) error {
+	active := strings.ToLower(p.Active)
+	if active == "" {
+		switch {
+		case p.Keycloak != nil:
+			active = ProviderKeycloakKey
+		case p.Generic != nil:
+			active = ProviderGenericKey
+		default:
+			return fmt.Errorf("no provider configured")
+		}
+	}
+
+	var errs models.Errors
+
+	var validator InfProviderValidate
+	switch active {
+	case ProviderKeycloakKey:
+		if p.Keycloak == nil {
+			errs = append(errs, fmt.Errorf("%s provider is active but not configured", active))
+		} else {
+			validator = p.Keycloak
+		}
+	case ProviderGenericKey:
+		if p.Generic == nil {
+			errs = append(errs, fmt.Errorf("%s provider is active but not configured", active))
+		} else {
+			validator = p.Generic
+		}
+	case ProviderNoopKey:
+		return nil
+	default:
+		errs = append(errs, fmt.Errorf("unknown active provider %q", p.Active))
+	}
+
+	if validator != nil {
+		if err := validator.Validate(uses...); err != nil {
+			errs = append(errs, fmt.Errorf("%s provider: %w", active, err))
+		}
+	}
+
+	if err := p.Client.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("client: %w", err))
+	}
+
+	if _, err := p.DPoP.DPoP(); err != nil {
+		errs = append(errs, fmt.Errorf("dpop: %w", err))
+	}
+
+	return errs.Err()
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/worldline-go/auth/models"
+	"github.com/worldline-go/auth/providers"
+	"github.com/worldline-go/auth/request"
+)
+
+func TestProvider_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *Provider
+		wantErrs int
+	}{
+		{
+			name: "valid",
+			provider: &Provider{
+				Generic: &providers.Generic{CertURL: "http://localhost/certs"},
+				Client:  &request.ClientPolicy{},
+				DPoP:    &request.DPoPConfig{},
+			},
+		},
+		{
+			name: "all errors",
+			provider: &Provider{
+				Generic: &providers.Generic{CertURL: "localhost/certs"},
+				Client: &request.ClientPolicy{
+					RetryWaitMin:   time.Minute,
+					RetryWaitMax:   time.Second,
+					BreakerTimeout: -1,
+				},
+				DPoP: &request.DPoPConfig{Key: "not a pem key"},
+			},
+			wantErrs: 3,
+		},
+		{
+			name: "not configured active provider",
+			provider: &Provider{
+				Active:  ProviderKeycloakKey,
+				Generic: &providers.Generic{CertURL: "http://localhost/certs"},
+				DPoP:    &request.DPoPConfig{Key: "not a pem key"},
+			},
+			wantErrs: 2,
+		},
+		{
+			name: "noop",
+			provider: &Provider{
+				Active: ProviderNoopKey,
+				DPoP:   &request.DPoPConfig{Key: "not a pem key"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.provider.Validate(providers.UseResourceServer)
+			if tt.wantErrs == 0 {
+				if err != nil {
+					t.Fatalf("Provider.Validate() error = %v", err)
+				}
+
+				return
+			}
+
+			errs, ok := err.(models.Errors)
+			if !ok {
+				t.Fatalf("Provider.Validate() error = %v, want models.Errors", err)
+			}
+
+			if len(errs) != tt.wantErrs {
+				t.Errorf("Provider.Validate() errors = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,702 @@
+package authtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/request"
+	"github.com/worldline-go/auth/store"
+)
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer(),
+		"authorization_endpoint":                s.URL + PathAuth,
+		"token_endpoint":                        s.URL + PathToken,
+		"introspection_endpoint":                s.URL + PathIntrospect,
+		"userinfo_endpoint":                     s.URL + PathUserInfo,
+		"end_session_endpoint":                  s.URL + PathLogout,
+		"device_authorization_endpoint":         s.URL + PathDevice,
+		"revocation_endpoint":                   s.URL + PathRevoke,
+		"pushed_authorization_request_endpoint": s.URL + PathPAR,
+		"jwks_uri":                              s.URL + PathCerts,
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials", "password", "refresh_token", request.GrantTypeDeviceCode, request.GrantTypeJWTBearer, request.GrantTypeTokenExchange},
+		"response_types_supported":              []string{"code"},
+		"token_endpoint_auth_methods_supported": s.authMethods(),
+		"code_challenge_methods_supported":      []string{"S256"},
+		"dpop_signing_alg_values_supported":     auth.DPoPAlgorithms,
+		"id_token_signing_alg_values_supported": []string{jwt.SigningMethodRS256.Alg()},
+	})
+}
+
+func (s *Server) handleCerts(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.jwks())
+}
+
+// handleAuth logins the user of login_hint or the first user without a page and redirects with the code.
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("client_id") != s.ClientID {
+		writeError(w, http.StatusBadRequest, "unauthorized_client", "unknown client_id")
+
+		return
+	}
+
+	// pushed parameters are used once
+	if requestURI := query.Get("request_uri"); requestURI != "" {
+		s.mutex.Lock()
+		pushed, ok := s.pushed[requestURI]
+		delete(s.pushed, requestURI)
+		s.mutex.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid_request_uri", "request_uri not valid")
+
+			return
+		}
+
+		query = pushed
+	}
+
+	if query.Get("response_type") != "code" {
+		writeError(w, http.StatusBadRequest, "unsupported_response_type", "only code is supported")
+
+		return
+	}
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Host == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid redirect_uri")
+
+		return
+	}
+
+	user := s.loginUser(query.Get("login_hint"))
+	if user == nil {
+		writeError(w, http.StatusBadRequest, "access_denied", "user not found")
+
+		return
+	}
+
+	codeChallenge := query.Get("code_challenge")
+	if codeChallenge != "" && query.Get("code_challenge_method") != "S256" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "only S256 code_challenge_method is supported")
+
+		return
+	}
+
+	code := randomString()
+
+	s.mutex.Lock()
+	s.codes[code] = grant{
+		user:          user,
+		scope:         joinScope(query.Get("scope")),
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: codeChallenge,
+	}
+	s.mutex.Unlock()
+
+	redirectQuery := redirectURI.Query()
+	redirectQuery.Set("code", code)
+	if state := query.Get("state"); state != "" {
+		redirectQuery.Set("state", state)
+	}
+
+	redirectURI.RawQuery = redirectQuery.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "method not allowed")
+
+		return
+	}
+
+	if !s.clientAuth(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+
+		return
+	}
+
+	jkt, ok := s.checkDPoP(w, r)
+	if !ok {
+		return
+	}
+
+	scope := joinScope(r.PostForm.Get("scope"))
+
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		s.writeToken(w, jkt, nil, scope, false)
+	case "password":
+		user, ok := s.users[r.PostForm.Get("username")]
+		if !ok || user.Password != r.PostForm.Get("password") {
+			writeError(w, http.StatusUnauthorized, "invalid_grant", "invalid user credentials")
+
+			return
+		}
+
+		s.writeToken(w, jkt, &user, scope, true)
+	case "authorization_code":
+		s.mutex.Lock()
+		g, ok := s.codes[r.PostForm.Get("code")]
+		delete(s.codes, r.PostForm.Get("code"))
+		s.mutex.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "code not valid")
+
+			return
+		}
+
+		if g.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "incorrect redirect_uri")
+
+			return
+		}
+
+		if g.codeChallenge != "" && store.CodeChallengeS256(r.PostForm.Get("code_verifier")) != g.codeChallenge {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+
+			return
+		}
+
+		s.writeToken(w, jkt, g.user, g.scope, true)
+	case "refresh_token":
+		s.mutex.Lock()
+		g, ok := s.refresh[r.PostForm.Get("refresh_token")]
+		delete(s.refresh, r.PostForm.Get("refresh_token"))
+		s.mutex.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+
+			return
+		}
+
+		if scope == "" {
+			scope = g.scope
+		}
+
+		s.writeToken(w, jkt, g.user, scope, true)
+	case request.GrantTypeJWTBearer:
+		// assertions signed with the server keys are trusted
+		claims, err := s.Parse(r.PostForm.Get("assertion"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+
+			return
+		}
+
+		subject, _ := claims["sub"].(string)
+		user := s.findUser(subject)
+		if user == nil {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "subject not found")
+
+			return
+		}
+
+		s.writeToken(w, jkt, user, scope, false)
+	case request.GrantTypeDeviceCode:
+		var d deviceGrant
+
+		s.mutex.Lock()
+		v, ok := s.devices[r.PostForm.Get("device_code")]
+		if ok {
+			d = *v
+			if d.user != nil || d.denied {
+				delete(s.devices, r.PostForm.Get("device_code"))
+			}
+		}
+		s.mutex.Unlock()
+
+		switch {
+		case !ok:
+			writeError(w, http.StatusBadRequest, "expired_token", "device code not found")
+		case d.denied:
+			writeError(w, http.StatusBadRequest, "access_denied", "user denied the authorization")
+		case d.user == nil:
+			writeError(w, http.StatusBadRequest, "authorization_pending", "user not authorized yet")
+		default:
+			s.writeToken(w, jkt, d.user, d.scope, true)
+		}
+	case request.GrantTypeTokenExchange:
+		s.exchangeToken(w, r, jkt, scope)
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant type")
+	}
+}
+
+// exchangeToken issues a token for the subject token signed with the server keys, RFC 8693.
+//
+// Audience and resource values are set to "aud", actor's subject to "act".
+func (s *Server) exchangeToken(w http.ResponseWriter, r *http.Request, jkt, scope string) {
+	subjectClaims, err := s.parseExchangeToken(r.PostForm.Get("subject_token"), r.PostForm.Get("subject_token_type"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "subject_token: "+err.Error())
+
+		return
+	}
+
+	issuedTokenType := r.PostForm.Get("requested_token_type")
+	switch issuedTokenType {
+	case "":
+		issuedTokenType = request.TokenTypeAccessToken
+	case request.TokenTypeAccessToken, request.TokenTypeJWT:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_request", "unsupported requested_token_type")
+
+		return
+	}
+
+	subject, _ := subjectClaims["sub"].(string)
+	user := s.findUser(subject)
+
+	if scope == "" {
+		scope, _ = subjectClaims["scope"].(string)
+	}
+
+	claims := s.userClaims(user, scope)
+	if user == nil {
+		claims["sub"] = subject
+	}
+
+	var audience []string
+	audience = append(audience, r.PostForm["audience"]...)
+	audience = append(audience, r.PostForm["resource"]...)
+	if len(audience) > 0 {
+		claims["aud"] = audience
+	}
+
+	if actorToken := r.PostForm.Get("actor_token"); actorToken != "" {
+		actorClaims, err := s.parseExchangeToken(actorToken, r.PostForm.Get("actor_token_type"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "actor_token: "+err.Error())
+
+			return
+		}
+
+		claims["act"] = map[string]interface{}{"sub": actorClaims["sub"]}
+	} else if r.PostForm.Get("actor_token_type") != "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "actor_token_type without actor_token")
+
+		return
+	}
+
+	s.writeTokenClaims(w, jkt, claims, nil, scope, false, map[string]interface{}{
+		"issued_token_type": issuedTokenType,
+	})
+}
+
+// parseExchangeToken validates the subject or actor token, only JWTs of the server are supported.
+func (s *Server) parseExchangeToken(token, tokenType string) (jwt.MapClaims, error) {
+	switch tokenType {
+	case request.TokenTypeAccessToken, request.TokenTypeJWT:
+	default:
+		return nil, fmt.Errorf("unsupported token type %q", tokenType)
+	}
+
+	return s.Parse(token)
+}
+
+func (s *Server) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if !s.clientAuth(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+
+		return
+	}
+
+	claims, err := s.Parse(r.PostForm.Get("token"))
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+
+		return
+	}
+
+	claims["active"] = true
+
+	writeJSON(w, http.StatusOK, claims)
+}
+
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	claims, err := s.Parse(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+
+		return
+	}
+
+	for _, k := range []string{"iss", "iat", "exp", "nbf", "jti", "typ", "azp", "scope"} {
+		delete(claims, k)
+	}
+
+	writeJSON(w, http.StatusOK, claims)
+}
+
+// handleDevice starts the device authorization, use ApproveDevice or DenyDevice to complete it.
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request) {
+	if !s.clientAuth(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+
+		return
+	}
+
+	deviceCode := randomString()
+	userCode := strings.ToUpper(randomString()[:8])
+
+	s.mutex.Lock()
+	s.devices[deviceCode] = &deviceGrant{
+		userCode: userCode,
+		scope:    joinScope(r.PostForm.Get("scope")),
+	}
+	s.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":               deviceCode,
+		"user_code":                 userCode,
+		"verification_uri":          s.URL + PathDevice,
+		"verification_uri_complete": s.URL + PathDevice + "?user_code=" + userCode,
+		"expires_in":                600,
+		"interval":                  5,
+	})
+}
+
+// handleRevoke revokes the refresh token or the access token with its jti.
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if !s.clientAuth(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+
+		return
+	}
+
+	token := r.PostForm.Get("token")
+
+	s.mutex.Lock()
+	delete(s.refresh, token)
+	s.mutex.Unlock()
+
+	// invalid tokens are not an error, RFC 7009 section 2.2
+	if claims, err := s.Parse(token); err == nil {
+		if jti, _ := claims["jti"].(string); jti != "" {
+			s.mutex.Lock()
+			s.revoked[jti] = struct{}{}
+			s.mutex.Unlock()
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlePAR stores the authorization request parameters of the authenticated client, RFC 9126.
+func (s *Server) handlePAR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "method not allowed")
+
+		return
+	}
+
+	if !s.clientAuth(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+
+		return
+	}
+
+	if r.PostForm.Get("request_uri") != "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "request_uri is not allowed")
+
+		return
+	}
+
+	params := url.Values{}
+	for k, v := range r.PostForm {
+		switch k {
+		case "client_secret", "client_assertion", "client_assertion_type":
+		default:
+			params[k] = v
+		}
+	}
+
+	params.Set("client_id", s.ClientID)
+
+	requestURI := "urn:ietf:params:oauth:request_uri:" + randomString()
+
+	s.mutex.Lock()
+	s.pushed[requestURI] = params
+	s.mutex.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"request_uri": requestURI,
+		"expires_in":  60,
+	})
+}
+
+// handleLogout removes the refresh token and redirects to post_logout_redirect_uri if exists.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+
+		return
+	}
+
+	if refreshToken := r.Form.Get("refresh_token"); refreshToken != "" {
+		s.mutex.Lock()
+		delete(s.refresh, refreshToken)
+		s.mutex.Unlock()
+	}
+
+	if redirectURI := r.Form.Get("post_logout_redirect_uri"); redirectURI != "" {
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) writeToken(w http.ResponseWriter, jkt string, user *User, scope string, withRefresh bool) {
+	s.writeTokenClaims(w, jkt, s.userClaims(user, scope), user, scope, withRefresh, nil)
+}
+
+// writeTokenClaims writes the token response of the claims, extra is added to the response.
+func (s *Server) writeTokenClaims(w http.ResponseWriter, jkt string, claims map[string]interface{}, user *User, scope string, withRefresh bool, extra map[string]interface{}) {
+	tokenType := "Bearer"
+	if jkt != "" {
+		claims["cnf"] = map[string]interface{}{"jkt": jkt}
+		tokenType = request.TokenTypeDPoP
+	}
+
+	accessToken, err := s.Token(claims)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+
+		return
+	}
+
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   tokenType,
+		"expires_in":   int(s.expire.Seconds()),
+	}
+
+	if scope != "" {
+		response["scope"] = scope
+	}
+
+	for k, v := range extra {
+		response[k] = v
+	}
+
+	if user != nil {
+		idClaims := s.userClaims(user, "")
+		idClaims["aud"] = s.ClientID
+		idClaims["typ"] = "ID"
+
+		idToken, err := s.Token(idClaims)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+
+			return
+		}
+
+		response["id_token"] = idToken
+	}
+
+	if withRefresh {
+		refreshToken := randomString()
+
+		s.mutex.Lock()
+		s.refresh[refreshToken] = grant{user: user, scope: scope}
+		s.mutex.Unlock()
+
+		response["refresh_token"] = refreshToken
+		response["refresh_expires_in"] = int(s.expire.Seconds()) * 6
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// checkDPoP validates the DPoP proof of the token request and returns the key thumbprint, empty if no proof.
+func (s *Server) checkDPoP(w http.ResponseWriter, r *http.Request) (string, bool) {
+	proof := r.Header.Get(request.HeaderDPoP)
+	if proof == "" {
+		return "", true
+	}
+
+	jkt, err := s.dpop.Verify(proof, r.Method, s.URL+PathToken, "")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, request.ErrorCodeInvalidDPoPProof, err.Error())
+
+		return "", false
+	}
+
+	if s.dpopNonce != "" {
+		claims := jwt.MapClaims{}
+		_, _, _ = jwt.NewParser().ParseUnverified(proof, claims)
+
+		if nonce, _ := claims["nonce"].(string); nonce != s.dpopNonce {
+			w.Header().Set(request.HeaderDPoPNonce, s.dpopNonce)
+			writeError(w, http.StatusBadRequest, request.ErrorCodeUseDPoPNonce, "nonce is required")
+
+			return "", false
+		}
+	}
+
+	return jkt, true
+}
+
+// authMethods returns the supported client authentication methods with the registered credentials.
+func (s *Server) authMethods() []string {
+	methods := []string{request.AuthMethodClientSecretBasic, request.AuthMethodClientSecretPost}
+	if s.assertionKey != nil {
+		methods = append(methods, request.AuthMethodPrivateKeyJWT)
+	}
+
+	if s.clientCert != nil {
+		methods = append(methods, request.AuthMethodTLSClientAuth)
+	}
+
+	return methods
+}
+
+// clientAuth checks client_secret_basic, client_secret_post, private_key_jwt or tls_client_auth authentication.
+func (s *Server) clientAuth(r *http.Request) bool {
+	if err := r.ParseForm(); err != nil {
+		return false
+	}
+
+	if r.PostForm.Get("client_assertion") != "" || r.PostForm.Get("client_assertion_type") != "" {
+		return s.clientAssertion(r)
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID != s.ClientID {
+		return false
+	}
+
+	if !ok && clientSecret == "" && s.clientCertificate(r) {
+		return true
+	}
+
+	return clientSecret == s.ClientSecret
+}
+
+// clientAssertion checks the private_key_jwt assertion with the registered key, jti is accepted once.
+func (s *Server) clientAssertion(r *http.Request) bool {
+	if s.assertionKey == nil || r.PostForm.Get("client_assertion_type") != request.ClientAssertionTypeJWTBearer {
+		return false
+	}
+
+	if clientID := r.PostForm.Get("client_id"); clientID != "" && clientID != s.ClientID {
+		return false
+	}
+
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(r.PostForm.Get("client_assertion"), &claims, func(_ *jwt.Token) (interface{}, error) {
+		return s.assertionKey, nil
+	}, jwt.WithIssuer(s.ClientID), jwt.WithSubject(s.ClientID))
+	if err != nil || claims.ExpiresAt == nil || claims.ID == "" {
+		return false
+	}
+
+	audience := false
+	for _, aud := range claims.Audience {
+		if aud == s.URL+PathToken || aud == s.Issuer() {
+			audience = true
+
+			break
+		}
+	}
+
+	if !audience {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.assertions[claims.ID]; ok {
+		return false
+	}
+
+	s.assertions[claims.ID] = struct{}{}
+
+	return true
+}
+
+// clientCertificate checks the tls_client_auth certificate with the registered certificate.
+func (s *Server) clientCertificate(r *http.Request) bool {
+	if s.clientCert == nil || r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false
+	}
+
+	return r.TLS.PeerCertificates[0].Equal(s.clientCert)
+}
+
+// findUser returns the user with the subject or username.
+func (s *Server) findUser(subject string) *User {
+	for _, user := range s.users {
+		user := user
+		if user.Subject == subject || user.Username == subject {
+			return &user
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) loginUser(username string) *User {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if username != "" {
+		if user, ok := s.users[username]; ok {
+			return &user
+		}
+
+		return nil
+	}
+
+	// first user in name order to be deterministic
+	var selected *User
+	for _, user := range s.users {
+		user := user
+		if selected == nil || user.Username < selected.Username {
+			selected = &user
+		}
+	}
+
+	return selected
+}
+
+func writeError(w http.ResponseWriter, code int, errCode, description string) {
+	writeJSON(w, code, map[string]string{
+		"error":             errCode,
+		"error_description": description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
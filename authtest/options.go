@@ -0,0 +1,97 @@
+package authtest
+
+import (
+	"crypto"
+	"crypto/x509"
+	"time"
+)
+
+// User is a resource owner of the password and authorization code flows.
+type User struct {
+	Username string
+	Password string
+	// Subject is the "sub" claim, default is the username.
+	Subject string
+	// Roles set to "realm_access.roles" claim.
+	Roles []string
+	// Claims are added to the tokens and userinfo response.
+	Claims map[string]interface{}
+}
+
+type options struct {
+	clientID     string
+	clientSecret string
+	kid          string
+	expire       time.Duration
+	users        []User
+	claims       map[string]interface{}
+	dpopNonce    string
+	assertionKey crypto.PublicKey
+	clientCert   *x509.Certificate
+}
+
+type Option func(*options)
+
+// WithClient sets the client credentials, default is "test" and "test-secret".
+func WithClient(clientID, clientSecret string) Option {
+	return func(opts *options) {
+		opts.clientID = clientID
+		opts.clientSecret = clientSecret
+	}
+}
+
+// WithKID sets the key id of the initial signing key, default is "test".
+func WithKID(kid string) Option {
+	return func(opts *options) {
+		opts.kid = kid
+	}
+}
+
+// WithTokenExpire sets the lifetime of the issued access tokens, default is 5 minutes.
+func WithTokenExpire(d time.Duration) Option {
+	return func(opts *options) {
+		opts.expire = d
+	}
+}
+
+// WithUser adds a user for the password and authorization code flows.
+func WithUser(user User) Option {
+	return func(opts *options) {
+		opts.users = append(opts.users, user)
+	}
+}
+
+// WithClaims sets the claims added to all issued access tokens.
+func WithClaims(claims map[string]interface{}) Option {
+	return func(opts *options) {
+		opts.claims = claims
+	}
+}
+
+// WithDPoPNonce requires the nonce in the DPoP proofs of the token requests.
+//
+// Token requests with DPoP proof are bound to the proof key without this option too.
+func WithDPoPNonce(nonce string) Option {
+	return func(opts *options) {
+		opts.dpopNonce = nonce
+	}
+}
+
+// WithClientAssertionKey registers the public key of the client for private_key_jwt.
+//
+// The client_assertion must be signed with the key, iss and sub are the client id,
+// aud is the token URL or the issuer.
+func WithClientAssertionKey(key crypto.PublicKey) Option {
+	return func(opts *options) {
+		opts.assertionKey = key
+	}
+}
+
+// WithClientCertificate registers the certificate of the client for tls_client_auth.
+//
+// Server starts with TLS and requests the client certificate, use the Client of the server to trust it.
+func WithClientCertificate(cert *x509.Certificate) Option {
+	return func(opts *options) {
+		opts.clientCert = cert
+	}
+}
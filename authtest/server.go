@@ -0,0 +1,414 @@
+// Package authtest provides an in-process OpenID provider for tests.
+//
+//	srv := authtest.NewServer(authtest.WithUser(authtest.User{Username: "user", Password: "pass"}))
+//	defer srv.Close()
+//
+//	providerConfig := auth.Provider{Generic: srv.Generic()}
+package authtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/providers"
+)
+
+// Endpoint paths of the server.
+const (
+	PathDiscovery  = "/.well-known/openid-configuration"
+	PathCerts      = "/protocol/openid-connect/certs"
+	PathAuth       = "/protocol/openid-connect/auth"
+	PathToken      = "/protocol/openid-connect/token"
+	PathIntrospect = "/protocol/openid-connect/token/introspect"
+	PathUserInfo   = "/protocol/openid-connect/userinfo"
+	PathLogout     = "/protocol/openid-connect/logout"
+	PathDevice     = "/protocol/openid-connect/auth/device"
+	PathRevoke     = "/protocol/openid-connect/revoke"
+	PathPAR        = "/protocol/openid-connect/ext/par/request"
+)
+
+// Server is a mock OpenID provider running on httptest.Server.
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	mutex   sync.RWMutex
+	keys    map[string]*rsa.PrivateKey
+	kid     string
+	expire  time.Duration
+	users   map[string]User
+	claims  map[string]interface{}
+	codes   map[string]grant
+	refresh map[string]grant
+	devices map[string]*deviceGrant
+	revoked map[string]struct{}
+	pushed  map[string]url.Values
+
+	dpop      auth.DPoPVerifier
+	dpopNonce string
+
+	assertionKey crypto.PublicKey
+	assertions   map[string]struct{}
+	clientCert   *x509.Certificate
+}
+
+// grant holds the owner of the code and refresh tokens.
+type grant struct {
+	user          *User
+	scope         string
+	redirectURI   string
+	codeChallenge string
+}
+
+// deviceGrant is the state of the device authorization.
+type deviceGrant struct {
+	userCode string
+	scope    string
+	user     *User
+	denied   bool
+}
+
+// NewServer starts a new server, it should be closed after use.
+//
+// Panics if the signing key cannot be generated.
+func NewServer(opts ...Option) *Server {
+	o := options{
+		clientID:     "test",
+		clientSecret: "test-secret",
+		kid:          "test",
+		expire:       5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &Server{
+		ClientID:     o.clientID,
+		ClientSecret: o.clientSecret,
+		keys:         make(map[string]*rsa.PrivateKey),
+		expire:       o.expire,
+		users:        make(map[string]User, len(o.users)),
+		claims:       o.claims,
+		codes:        make(map[string]grant),
+		refresh:      make(map[string]grant),
+		devices:      make(map[string]*deviceGrant),
+		revoked:      make(map[string]struct{}),
+		pushed:       make(map[string]url.Values),
+		dpopNonce:    o.dpopNonce,
+		assertionKey: o.assertionKey,
+		assertions:   make(map[string]struct{}),
+		clientCert:   o.clientCert,
+	}
+
+	for _, user := range o.users {
+		s.users[user.Username] = user
+	}
+
+	if err := s.AddKey(o.kid); err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathDiscovery, s.handleDiscovery)
+	mux.HandleFunc(PathCerts, s.handleCerts)
+	mux.HandleFunc(PathAuth, s.handleAuth)
+	mux.HandleFunc(PathToken, s.handleToken)
+	mux.HandleFunc(PathIntrospect, s.handleIntrospect)
+	mux.HandleFunc(PathUserInfo, s.handleUserInfo)
+	mux.HandleFunc(PathLogout, s.handleLogout)
+	mux.HandleFunc(PathDevice, s.handleDevice)
+	mux.HandleFunc(PathRevoke, s.handleRevoke)
+	mux.HandleFunc(PathPAR, s.handlePAR)
+
+	if s.clientCert == nil {
+		s.Server = httptest.NewServer(mux)
+
+		return s
+	}
+
+	s.Server = httptest.NewUnstartedServer(mux)
+	s.Server.TLS = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequestClientCert,
+	}
+	s.Server.StartTLS()
+
+	return s
+}
+
+// Issuer returns the issuer of the tokens.
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// Generic returns the provider config pointing to the server.
+func (s *Server) Generic() *providers.Generic {
+	return &providers.Generic{
+		ClientID:      s.ClientID,
+		ClientSecret:  s.ClientSecret,
+		CertURL:       s.URL + PathCerts,
+		IntrospectURL: s.URL + PathIntrospect,
+		AuthURL:       s.URL + PathAuth,
+		TokenURL:      s.URL + PathToken,
+		LogoutURL:     s.URL + PathLogout,
+		UserInfoURL:   s.URL + PathUserInfo,
+		DeviceAuthURL: s.URL + PathDevice,
+		RevocationURL: s.URL + PathRevoke,
+		PARURL:        s.URL + PathPAR,
+	}
+}
+
+// AddKey adds a new signing key and uses it for the next tokens.
+//
+// Previous keys stay in the JWKS to validate old tokens.
+func (s *Server) AddKey(kid string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.keys[kid] = key
+	s.kid = kid
+
+	return nil
+}
+
+// RemoveKey removes the key from the JWKS, tokens signed with it become invalid.
+func (s *Server) RemoveKey(kid string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.keys, kid)
+}
+
+// Token returns a signed access token with the current key.
+//
+// Claims override the default claims; iss, iat, exp and jti are set if not exist.
+func (s *Server) Token(claims map[string]interface{}) (string, error) {
+	s.mutex.RLock()
+	kid := s.kid
+	s.mutex.RUnlock()
+
+	return s.TokenWithKID(kid, claims)
+}
+
+// TokenWithKID returns a signed access token with the given key id.
+//
+// Unknown key id is signed with a new key not in the JWKS, useful to test invalid signatures.
+func (s *Server) TokenWithKID(kid string, claims map[string]interface{}) (string, error) {
+	s.mutex.RLock()
+	key, ok := s.keys[kid]
+	s.mutex.RUnlock()
+
+	if !ok {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate key: %w", err)
+		}
+	}
+
+	now := time.Now()
+	mapClaims := jwt.MapClaims{
+		"iss": s.Issuer(),
+		"iat": now.Unix(),
+		"exp": now.Add(s.expire).Unix(),
+		"jti": randomString(),
+	}
+
+	for k, v := range claims {
+		mapClaims[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, mapClaims)
+	token.Header["kid"] = kid
+
+	return token.SignedString(key)
+}
+
+// Parse validates the token with the server keys.
+func (s *Server) Parse(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("kid %q not found", kid)
+		}
+
+		return key.Public(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	if jti, _ := claims["jti"].(string); s.isRevoked(jti) {
+		return nil, fmt.Errorf("token revoked")
+	}
+
+	return claims, nil
+}
+
+// IsRefreshTokenActive reports the refresh token is issued and not used or revoked.
+func (s *Server) IsRefreshTokenActive(refreshToken string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.refresh[refreshToken]
+
+	return ok
+}
+
+func (s *Server) isRevoked(jti string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.revoked[jti]
+
+	return ok
+}
+
+// ApproveDevice authorizes the device of the user code as the user.
+func (s *Server) ApproveDevice(userCode, username string) error {
+	return s.setDevice(userCode, func(d *deviceGrant) error {
+		user, ok := s.users[username]
+		if !ok {
+			return fmt.Errorf("user %q not found", username)
+		}
+
+		d.user = &user
+
+		return nil
+	})
+}
+
+// DenyDevice denies the device of the user code.
+func (s *Server) DenyDevice(userCode string) error {
+	return s.setDevice(userCode, func(d *deviceGrant) error {
+		d.denied = true
+
+		return nil
+	})
+}
+
+func (s *Server) setDevice(userCode string, fn func(d *deviceGrant) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, d := range s.devices {
+		if d.userCode == userCode {
+			return fn(d)
+		}
+	}
+
+	return fmt.Errorf("user code %q not found", userCode)
+}
+
+// userClaims returns the token claims of the user.
+func (s *Server) userClaims(user *User, scope string) map[string]interface{} {
+	claims := make(map[string]interface{}, len(s.claims)+8)
+	for k, v := range s.claims {
+		claims[k] = v
+	}
+
+	claims["azp"] = s.ClientID
+	claims["typ"] = "Bearer"
+
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	if user == nil {
+		claims["sub"] = "service-account-" + s.ClientID
+		claims["preferred_username"] = "service-account-" + s.ClientID
+
+		return claims
+	}
+
+	subject := user.Subject
+	if subject == "" {
+		subject = user.Username
+	}
+
+	claims["sub"] = subject
+	claims["preferred_username"] = user.Username
+
+	if len(user.Roles) > 0 {
+		claims["realm_access"] = map[string]interface{}{
+			"roles": user.Roles,
+		}
+	}
+
+	for k, v := range user.Claims {
+		claims[k] = v
+	}
+
+	return claims
+}
+
+func (s *Server) jwks() map[string]interface{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	kids := make([]string, 0, len(s.keys))
+	for kid := range s.keys {
+		kids = append(kids, kid)
+	}
+
+	sort.Strings(kids)
+
+	keys := make([]map[string]interface{}, 0, len(kids))
+	for _, kid := range kids {
+		public := s.keys[kid].PublicKey
+
+		keys = append(keys, map[string]interface{}{
+			"kid": kid,
+			"kty": "RSA",
+			"alg": jwt.SigningMethodRS256.Alg(),
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		})
+	}
+
+	return map[string]interface{}{
+		"keys": keys,
+	}
+}
+
+func joinScope(scope string) string {
+	return strings.Join(strings.Fields(scope), " ")
+}
+
+func randomString() string {
+	v := make([]byte, 16)
+	_, _ = rand.Read(v)
+
+	return hex.EncodeToString(v)
+}
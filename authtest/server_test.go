@@ -0,0 +1,782 @@
+package authtest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/claims"
+	"github.com/worldline-go/auth/request"
+	"github.com/worldline-go/auth/store"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer(WithUser(User{
+		Username: "user",
+		Password: "pass",
+		Roles:    []string{"admin"},
+		Claims: map[string]interface{}{
+			"email": "user@example.com",
+		},
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	generic := srv.Generic()
+
+	jwks, err := (&auth.Provider{Generic: generic}).ActiveProvider().JWTKeyFunc(auth.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authRequestConfig := request.AuthRequestConfig{
+		TokenURL:     generic.TokenURL,
+		ClientID:     generic.ClientID,
+		ClientSecret: generic.ClientSecret,
+	}
+
+	parse := func(t *testing.T, body []byte) (*request.TokenResponse, *claims.Custom) {
+		t.Helper()
+
+		token, err := request.DecodeToken(body, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		customClaims := &claims.Custom{}
+		if _, err := jwks.ParseWithClaims(token.AccessToken, customClaims); err != nil {
+			t.Fatal(err)
+		}
+
+		return token, customClaims
+	}
+
+	t.Run("client credentials", func(t *testing.T) {
+		token, err := request.DecodeToken(request.DefaultAuth.ClientCredentials(ctx, request.ClientCredentialsConfig{
+			AuthRequestConfig: authRequestConfig,
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.RefreshToken != "" || token.Expiry.Before(time.Now()) {
+			t.Errorf("unexpected token: %q %v", token.RefreshToken, token.Expiry)
+		}
+
+		_, customClaims := parse(t, token.Raw)
+		if customClaims.User != "service-account-test" {
+			t.Errorf("unexpected user: %v", customClaims.User)
+		}
+
+		_, err = request.DefaultAuth.ClientCredentials(ctx, request.ClientCredentialsConfig{
+			AuthRequestConfig: request.AuthRequestConfig{
+				TokenURL:     generic.TokenURL,
+				ClientID:     generic.ClientID,
+				ClientSecret: "wrong",
+			},
+		})
+		if !request.IsErrorCode(err, request.ErrorCodeInvalidClient) {
+			t.Errorf("expected invalid_client, got %v", err)
+		}
+	})
+
+	t.Run("password and refresh", func(t *testing.T) {
+		body, err := request.DefaultAuth.Password(ctx, request.PassswordConfig{
+			Username:          "user",
+			Password:          "pass",
+			AuthRequestConfig: authRequestConfig,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, customClaims := parse(t, body)
+		if !customClaims.HasRole("admin") || customClaims.Map["email"] != "user@example.com" {
+			t.Errorf("unexpected claims: %v", customClaims.Map)
+		}
+
+		body, err = request.DefaultAuth.RefreshToken(ctx, request.RefreshTokenConfig{
+			RefreshToken:      token.RefreshToken,
+			AuthRequestConfig: authRequestConfig,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, customClaims := parse(t, body); customClaims.User != "user" {
+			t.Errorf("unexpected user: %v", customClaims.User)
+		}
+
+		_, err = request.DefaultAuth.RefreshToken(ctx, request.RefreshTokenConfig{
+			RefreshToken:      token.RefreshToken,
+			AuthRequestConfig: authRequestConfig,
+		})
+		if !request.IsErrorCode(err, request.ErrorCodeInvalidGrant) {
+			t.Errorf("expected invalid_grant for used refresh token, got %v", err)
+		}
+
+		var oauthErr *request.OAuthError
+		if !errors.As(err, &oauthErr) || oauthErr.StatusCode != http.StatusBadRequest || oauthErr.ErrorDescription == "" {
+			t.Errorf("unexpected error: %#v", err)
+		}
+	})
+
+	t.Run("authorization code", func(t *testing.T) {
+		client := &http.Client{
+			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		codeVerifier, err := store.NewCodeVerifier()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		redirectURL := "http://localhost/callback"
+		resp, err := client.Get(generic.AuthURL + "?" + url.Values{
+			"response_type":         {"code"},
+			"client_id":             {generic.ClientID},
+			"redirect_uri":          {redirectURL},
+			"state":                 {"xyz"},
+			"code_challenge":        {store.CodeChallengeS256(codeVerifier)},
+			"code_challenge_method": {"S256"},
+		}.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		location, err := resp.Location()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if location.Query().Get("state") != "xyz" {
+			t.Errorf("state not returned: %v", location)
+		}
+
+		body, err := request.DefaultAuth.AuthorizationCode(ctx, request.AuthorizationCodeConfig{
+			Code:              location.Query().Get("code"),
+			RedirectURL:       redirectURL,
+			CodeVerifier:      codeVerifier,
+			AuthRequestConfig: authRequestConfig,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, _ := parse(t, body)
+		if token.IDToken == "" {
+			t.Errorf("id_token not returned")
+		}
+	})
+
+	t.Run("pushed authorization request", func(t *testing.T) {
+		client := &http.Client{
+			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		redirectURL := "http://localhost/callback"
+		pushed, err := request.DefaultAuth.PushedAuthorization(ctx, request.PushedAuthorizationConfig{
+			PARURL: generic.PARURL,
+			Params: url.Values{
+				"response_type": {"code"},
+				"redirect_uri":  {redirectURL},
+				"state":         {"xyz"},
+			},
+			AuthRequestConfig: authRequestConfig,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authURL := request.PushedAuthorizationURL(generic.AuthURL, generic.ClientID, pushed.RequestURI)
+
+		resp, err := client.Get(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		location, err := resp.Location()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if location.Query().Get("state") != "xyz" || location.Query().Get("code") == "" {
+			t.Errorf("code and state not returned: %v", location)
+		}
+
+		// request_uri is one-time use
+		resp, err = client.Get(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("reused request_uri status = %v, want %v", resp.StatusCode, http.StatusBadRequest)
+		}
+
+		_, err = request.DefaultAuth.PushedAuthorization(ctx, request.PushedAuthorizationConfig{
+			PARURL: generic.PARURL,
+			AuthRequestConfig: request.AuthRequestConfig{
+				TokenURL:     generic.TokenURL,
+				ClientID:     generic.ClientID,
+				ClientSecret: "wrong",
+			},
+		})
+		if !request.IsErrorCode(err, request.ErrorCodeInvalidClient) {
+			t.Errorf("PushedAuthorization() error = %v, want invalid_client", err)
+		}
+	})
+
+	t.Run("device", func(t *testing.T) {
+		for _, deny := range []bool{false, true} {
+			device, err := request.DefaultAuth.DeviceAuthorization(ctx, request.DeviceAuthorizationConfig{
+				DeviceAuthURL:     generic.DeviceAuthURL,
+				AuthRequestConfig: authRequestConfig,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if device.UserCode == "" || device.VerificationURI == "" {
+				t.Fatalf("unexpected device response: %+v", device)
+			}
+
+			tokenConfig := device.DeviceTokenConfig(authRequestConfig)
+			tokenConfig.Interval = 10 * time.Millisecond
+
+			time.AfterFunc(50*time.Millisecond, func() {
+				if deny {
+					_ = srv.DenyDevice(device.UserCode)
+				} else {
+					_ = srv.ApproveDevice(device.UserCode, "user")
+				}
+			})
+
+			body, err := request.DefaultAuth.DeviceToken(ctx, tokenConfig)
+			if deny {
+				if !errors.Is(err, request.ErrDeviceAccessDenied) {
+					t.Errorf("expected access denied, got %v", err)
+				}
+
+				continue
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, customClaims := parse(t, body); customClaims.User != "user" {
+				t.Errorf("unexpected user: %v", customClaims.User)
+			}
+		}
+	})
+
+	t.Run("jwt bearer", func(t *testing.T) {
+		assertion, err := srv.Token(map[string]interface{}{
+			"sub": "user",
+			"aud": srv.Issuer(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := request.DefaultAuth.JWTBearer(ctx, request.JWTBearerConfig{
+			Assertion:         assertion,
+			AuthRequestConfig: authRequestConfig,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, customClaims := parse(t, body); customClaims.User != "user" {
+			t.Errorf("unexpected user: %v", customClaims.User)
+		}
+	})
+
+	t.Run("token exchange", func(t *testing.T) {
+		subjectToken, err := srv.Token(map[string]interface{}{"sub": "user", "scope": "read"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actorToken, err := srv.Token(map[string]interface{}{"sub": "service-a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name    string
+			cfg     request.TokenExchangeConfig
+			wantErr bool
+			check   func(t *testing.T, token *request.TokenResponse, claims jwt.MapClaims)
+		}{
+			{
+				name: "audience and resource",
+				cfg: request.TokenExchangeConfig{
+					SubjectToken: subjectToken,
+					Audience:     []string{"service-b", "service-c"},
+					Resource:     []string{"https://service-d"},
+				},
+				check: func(t *testing.T, token *request.TokenResponse, claims jwt.MapClaims) {
+					aud, _ := claims.GetAudience()
+					if !reflect.DeepEqual([]string(aud), []string{"service-b", "service-c", "https://service-d"}) {
+						t.Errorf("aud = %v", aud)
+					}
+
+					if claims["sub"] != "user" || claims["scope"] != "read" {
+						t.Errorf("subject claims not kept: %v", claims)
+					}
+
+					if token.IssuedTokenType != request.TokenTypeAccessToken {
+						t.Errorf("issued_token_type = %q", token.IssuedTokenType)
+					}
+				},
+			},
+			{
+				name: "actor and requested token type",
+				cfg: request.TokenExchangeConfig{
+					SubjectToken:       subjectToken,
+					SubjectTokenType:   request.TokenTypeJWT,
+					ActorToken:         actorToken,
+					RequestedTokenType: request.TokenTypeJWT,
+				},
+				check: func(t *testing.T, token *request.TokenResponse, claims jwt.MapClaims) {
+					act, _ := claims["act"].(map[string]interface{})
+					if act["sub"] != "service-a" {
+						t.Errorf("act = %v", claims["act"])
+					}
+
+					if token.IssuedTokenType != request.TokenTypeJWT {
+						t.Errorf("issued_token_type = %q", token.IssuedTokenType)
+					}
+				},
+			},
+			{
+				name: "unsupported subject token type",
+				cfg: request.TokenExchangeConfig{
+					SubjectToken:     subjectToken,
+					SubjectTokenType: request.TokenTypeRefreshToken,
+				},
+				wantErr: true,
+			},
+			{
+				name: "unsupported requested token type",
+				cfg: request.TokenExchangeConfig{
+					SubjectToken:       subjectToken,
+					RequestedTokenType: request.TokenTypeIDToken,
+				},
+				wantErr: true,
+			},
+			{
+				name: "invalid subject token",
+				cfg: request.TokenExchangeConfig{
+					SubjectToken: "invalid",
+				},
+				wantErr: true,
+			},
+			{
+				name:    "empty subject token",
+				cfg:     request.TokenExchangeConfig{},
+				wantErr: true,
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tt.cfg.AuthRequestConfig = authRequestConfig
+
+				token, err := request.DecodeToken(request.DefaultAuth.TokenExchange(ctx, tt.cfg))
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("TokenExchange() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if tt.wantErr {
+					return
+				}
+
+				claims, err := srv.Parse(token.AccessToken)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				tt.check(t, token, claims)
+			})
+		}
+	})
+
+	t.Run("dpop", func(t *testing.T) {
+		srvDPoP := NewServer(WithDPoPNonce("test-nonce"))
+		defer srvDPoP.Close()
+
+		verifier := &auth.DPoPVerifier{}
+		resource := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), request.TokenTypeDPoP+" ")
+			if accessToken == r.Header.Get("Authorization") {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			jkt, err := verifier.Verify(r.Header.Get(request.HeaderDPoP), r.Method, "http://"+r.Host+r.URL.Path, accessToken)
+			if err != nil || auth.Confirmation(accessToken)["jkt"] != jkt {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer resource.Close()
+
+		dpopConfig := &request.DPoPConfig{}
+		provider := (&auth.Provider{Generic: srvDPoP.Generic(), DPoP: dpopConfig}).ActiveProvider()
+
+		shared, err := provider.NewOauth2Shared(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		roundTripper, err := shared.RoundTripper(ctx, http.DefaultTransport)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := &http.Client{Transport: roundTripper}
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(resource.URL + "/resource?x=1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %v, want %v", resp.StatusCode, http.StatusOK)
+			}
+		}
+
+		dpop, _ := dpopConfig.DPoP()
+		if nonce := dpop.Nonce(srvDPoP.URL); nonce != "test-nonce" {
+			t.Errorf("nonce = %v, want %v", nonce, "test-nonce")
+		}
+
+		// proof is bound to the method
+		proof, err := dpop.Proof(http.MethodPost, srvDPoP.URL+PathToken, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := verifier.Verify(proof, http.MethodGet, srvDPoP.URL+PathToken, ""); !errors.Is(err, auth.ErrDPoPProof) {
+			t.Errorf("Verify() htm mismatch error = %v", err)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		body, err := request.DefaultAuth.Password(ctx, request.PassswordConfig{
+			Username:          "user",
+			Password:          "pass",
+			AuthRequestConfig: authRequestConfig,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, _ := parse(t, body)
+
+		for _, v := range []struct {
+			token string
+			hint  string
+		}{
+			{token: token.RefreshToken, hint: request.TokenTypeHintRefreshToken},
+			{token: token.AccessToken, hint: request.TokenTypeHintAccessToken},
+		} {
+			if err := request.DefaultAuth.Revoke(ctx, request.RevokeConfig{
+				RevocationURL:     generic.RevocationURL,
+				Token:             v.token,
+				TokenTypeHint:     v.hint,
+				AuthRequestConfig: authRequestConfig,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if srv.IsRefreshTokenActive(token.RefreshToken) {
+			t.Errorf("refresh token is active after revoke")
+		}
+
+		if _, err := srv.Parse(token.AccessToken); err == nil {
+			t.Errorf("access token is active after revoke")
+		}
+	})
+
+	t.Run("introspect", func(t *testing.T) {
+		accessToken, err := srv.Token(map[string]interface{}{"sub": "1234"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		introspect := &auth.IntrospectJWTKey{
+			URL:          generic.IntrospectURL,
+			ClientID:     generic.ClientID,
+			ClientSecret: generic.ClientSecret,
+			Ctx:          ctx,
+		}
+
+		if _, err := introspect.ParseWithClaims(accessToken, &claims.Custom{}); err != nil {
+			t.Fatal(err)
+		}
+
+		invalidToken, err := srv.TokenWithKID("unknown", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := introspect.ParseWithClaims(invalidToken, &claims.Custom{}); err == nil {
+			t.Errorf("token with unknown kid is active")
+		}
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		oldToken, err := srv.Token(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := srv.AddKey("rotated"); err != nil {
+			t.Fatal(err)
+		}
+
+		newToken, err := srv.Token(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jwksRotated, err := (&auth.Provider{Generic: generic}).ActiveProvider().JWTKeyFunc(auth.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, accessToken := range []string{oldToken, newToken} {
+			if _, err := jwksRotated.ParseWithClaims(accessToken, &claims.Custom{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		srv.RemoveKey("test")
+		if _, err := srv.Parse(oldToken); err == nil {
+			t.Errorf("token of removed key is valid")
+		}
+	})
+}
+
+func TestServer_ClientAuth(t *testing.T) {
+	newKey := func(t *testing.T) *ecdsa.PrivateKey {
+		t.Helper()
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return key
+	}
+
+	newCertificate := func(t *testing.T) *tls.Certificate {
+		t.Helper()
+
+		key := newKey(t)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		leaf, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	}
+
+	clientCredentials := func(srv *Server, clientAuth *request.ClientAuth) error {
+		client, err := clientAuth.HTTPClient(srv.Client())
+		if err != nil {
+			return err
+		}
+
+		_, err = (&request.Auth{Client: client}).ClientCredentials(context.Background(), request.ClientCredentialsConfig{
+			AuthRequestConfig: clientAuth.AuthRequestConfig(srv.URL + PathToken),
+		})
+
+		return err
+	}
+
+	key := newKey(t)
+	cert := newCertificate(t)
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		clientAuth func(t *testing.T, srv *Server) *request.ClientAuth
+		wantErr    bool
+	}{
+		{
+			name: "private_key_jwt",
+			opts: []Option{WithClientAssertionKey(&key.PublicKey)},
+			clientAuth: func(_ *testing.T, srv *Server) *request.ClientAuth {
+				return &request.ClientAuth{
+					Method:          request.AuthMethodPrivateKeyJWT,
+					ClientID:        srv.ClientID,
+					TokenURL:        srv.URL + PathToken,
+					ClientAssertion: request.NewClientAssertion(jwt.SigningMethodES256, key, ""),
+				}
+			},
+		},
+		{
+			name: "private_key_jwt wrong key",
+			opts: []Option{WithClientAssertionKey(&key.PublicKey)},
+			clientAuth: func(t *testing.T, srv *Server) *request.ClientAuth {
+				return &request.ClientAuth{
+					Method:          request.AuthMethodPrivateKeyJWT,
+					ClientID:        srv.ClientID,
+					TokenURL:        srv.URL + PathToken,
+					ClientAssertion: request.NewClientAssertion(jwt.SigningMethodES256, newKey(t), ""),
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "private_key_jwt wrong audience",
+			opts: []Option{WithClientAssertionKey(&key.PublicKey)},
+			clientAuth: func(_ *testing.T, srv *Server) *request.ClientAuth {
+				return &request.ClientAuth{
+					Method:          request.AuthMethodPrivateKeyJWT,
+					ClientID:        srv.ClientID,
+					TokenURL:        "https://localhost/token",
+					ClientAssertion: request.NewClientAssertion(jwt.SigningMethodES256, key, ""),
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "private_key_jwt replay",
+			opts: []Option{WithClientAssertionKey(&key.PublicKey)},
+			clientAuth: func(t *testing.T, srv *Server) *request.ClientAuth {
+				assertion, err := request.NewClientAssertion(jwt.SigningMethodES256, key, "")(srv.ClientID, srv.URL+PathToken)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				clientAuth := &request.ClientAuth{
+					Method:   request.AuthMethodPrivateKeyJWT,
+					ClientID: srv.ClientID,
+					TokenURL: srv.URL + PathToken,
+					ClientAssertion: func(_, _ string) (string, error) {
+						return assertion, nil
+					},
+				}
+
+				if err := clientCredentials(srv, clientAuth); err != nil {
+					t.Fatal(err)
+				}
+
+				return clientAuth
+			},
+			wantErr: true,
+		},
+		{
+			name: "private_key_jwt not registered",
+			clientAuth: func(_ *testing.T, srv *Server) *request.ClientAuth {
+				return &request.ClientAuth{
+					Method:          request.AuthMethodPrivateKeyJWT,
+					ClientID:        srv.ClientID,
+					TokenURL:        srv.URL + PathToken,
+					ClientAssertion: request.NewClientAssertion(jwt.SigningMethodES256, key, ""),
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "tls_client_auth",
+			opts: []Option{WithClientCertificate(cert.Leaf)},
+			clientAuth: func(_ *testing.T, srv *Server) *request.ClientAuth {
+				return &request.ClientAuth{
+					Method:      request.AuthMethodTLSClientAuth,
+					ClientID:    srv.ClientID,
+					Certificate: cert,
+				}
+			},
+		},
+		{
+			name: "tls_client_auth wrong certificate",
+			opts: []Option{WithClientCertificate(cert.Leaf)},
+			clientAuth: func(t *testing.T, srv *Server) *request.ClientAuth {
+				return &request.ClientAuth{
+					Method:      request.AuthMethodTLSClientAuth,
+					ClientID:    srv.ClientID,
+					Certificate: newCertificate(t),
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "tls_client_auth without secret",
+			opts: []Option{WithClientCertificate(cert.Leaf)},
+			clientAuth: func(_ *testing.T, srv *Server) *request.ClientAuth {
+				return &request.ClientAuth{
+					Method:   request.AuthMethodClientSecretPost,
+					ClientID: srv.ClientID,
+				}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(tt.opts...)
+			defer srv.Close()
+
+			err := clientCredentials(srv, tt.clientAuth(t, srv))
+			if tt.wantErr {
+				if !request.IsErrorCode(err, request.ErrorCodeInvalidClient) {
+					t.Errorf("expected invalid_client, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -95,3 +95,42 @@ func (c *Custom) HasScope(scope string) bool {
 
 	return false
 }
+
+// Merge adds the values of other claims which are not in the claims, like userinfo response.
+//
+// Role and scope sets are merged.
+func (c *Custom) Merge(other *Custom) {
+	if other == nil {
+		return
+	}
+
+	if c.User == "" {
+		c.User = other.User
+	}
+
+	if c.Map == nil {
+		c.Map = make(map[string]interface{}, len(other.Map))
+	}
+
+	for k, v := range other.Map {
+		if _, ok := c.Map[k]; !ok {
+			c.Map[k] = v
+		}
+	}
+
+	if c.RoleSet == nil {
+		c.RoleSet = make(map[string]struct{}, len(other.RoleSet))
+	}
+
+	for role := range other.RoleSet {
+		c.RoleSet[role] = struct{}{}
+	}
+
+	if c.ScopeSet == nil {
+		c.ScopeSet = make(map[string]struct{}, len(other.ScopeSet))
+	}
+
+	for scope := range other.ScopeSet {
+		c.ScopeSet[scope] = struct{}{}
+	}
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth/request"
+)
+
+var (
+	// ErrDPoPProof is wrapped by the errors of the DPoP proof validation.
+	ErrDPoPProof = errors.New("invalid dpop proof")
+	// ErrDPoPNotBound is returned when the proof key is not the key of the token.
+	ErrDPoPNotBound = errors.New("token is not bound to the dpop proof key")
+)
+
+// DefaultDPoPProofAge is the accepted difference of the proof's iat to the current time.
+var DefaultDPoPProofAge = time.Minute
+
+// DPoPAlgorithms are the accepted signing algorithms of the proofs.
+var DPoPAlgorithms = []string{
+	jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodRS256.Alg(), jwt.SigningMethodRS384.Alg(), jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(), jwt.SigningMethodPS384.Alg(), jwt.SigningMethodPS512.Alg(),
+}
+
+// DefaultDPoPReplayMax is the maximum count of the kept jti values, proofs are rejected at the limit.
+var DefaultDPoPReplayMax = 100000
+
+// dpopReplaySweepInterval is the interval to remove the expired jti values.
+var dpopReplaySweepInterval = 10 * time.Second
+
+// DPoPVerifier validates the DPoP proofs of the requests, RFC 9449 section 4.3.
+//
+// Used jti values are kept in memory until the proof age to reject replays.
+type DPoPVerifier struct {
+	// ProofAge is the accepted difference of iat, default is DefaultDPoPProofAge.
+	ProofAge time.Duration
+	// ReplayMax is the maximum count of the kept jti values, default is DefaultDPoPReplayMax.
+	//
+	// Proofs are rejected at the limit until the jti values expire, replays are never accepted.
+	ReplayMax int
+
+	mutex sync.Mutex
+	seen  map[string]time.Time
+	sweep time.Time
+}
+
+// Verify validates the proof of the request and returns the JWK thumbprint of the proof key.
+//
+// htu is the request URL without query and fragment, accessToken is checked with the ath claim if not empty.
+func (v *DPoPVerifier) Verify(proof, method, htu, accessToken string) (string, error) {
+	return v.verify(proof, method, htu, accessToken, "")
+}
+
+// VerifyBound validates the proof like Verify and checks the proof key is the jkt of the token.
+//
+// Returns ErrDPoPNotBound if the key is different, jti is kept only for the valid proofs.
+func (v *DPoPVerifier) VerifyBound(proof, method, htu, accessToken, jkt string) error {
+	if jkt == "" {
+		return ErrDPoPNotBound
+	}
+
+	_, err := v.verify(proof, method, htu, accessToken, jkt)
+
+	return err
+}
+
+// verify validates the proof, jkt is checked before using the jti if not empty.
+func (v *DPoPVerifier) verify(proof, method, htu, accessToken, jkt string) (string, error) {
+	proofAge := v.ProofAge
+	if proofAge <= 0 {
+		proofAge = DefaultDPoPProofAge
+	}
+
+	var thumbprint string
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.NewParser(jwt.WithValidMethods(DPoPAlgorithms)).ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != request.DPoPProofType {
+			return nil, fmt.Errorf("typ is not %s", request.DPoPProofType)
+		}
+
+		jwk, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("jwk header is missing")
+		}
+
+		key, err := request.PublicKeyFromJWK(jwk)
+		if err != nil {
+			return nil, err
+		}
+
+		thumbprint, err = request.JWKThumbprint(jwk)
+		if err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDPoPProof, err)
+	}
+
+	if v, _ := claims["htm"].(string); v != method {
+		return "", fmt.Errorf("%w: htm mismatch", ErrDPoPProof)
+	}
+
+	if v, _ := claims["htu"].(string); v != htu {
+		return "", fmt.Errorf("%w: htu mismatch", ErrDPoPProof)
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return "", fmt.Errorf("%w: iat is missing", ErrDPoPProof)
+	}
+
+	now := time.Now()
+	if iat.Before(now.Add(-proofAge)) || iat.After(now.Add(proofAge)) {
+		return "", fmt.Errorf("%w: iat is not in the accepted window", ErrDPoPProof)
+	}
+
+	if accessToken != "" {
+		if v, _ := claims["ath"].(string); v != request.AccessTokenHash(accessToken) {
+			return "", fmt.Errorf("%w: ath mismatch", ErrDPoPProof)
+		}
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", fmt.Errorf("%w: jti is missing", ErrDPoPProof)
+	}
+
+	if jkt != "" && jkt != thumbprint {
+		return "", ErrDPoPNotBound
+	}
+
+	if err := v.use(thumbprint+":"+jti, iat.Add(proofAge)); err != nil {
+		return "", err
+	}
+
+	return thumbprint, nil
+}
+
+// use reports the jti is not used before and holds it until the expire time.
+func (v *DPoPVerifier) use(jti string, expire time.Time) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	now := time.Now()
+
+	if v.seen == nil {
+		v.seen = make(map[string]time.Time)
+	}
+
+	if now.After(v.sweep) {
+		for k, e := range v.seen {
+			if now.After(e) {
+				delete(v.seen, k)
+			}
+		}
+
+		v.sweep = now.Add(dpopReplaySweepInterval)
+	}
+
+	if e, ok := v.seen[jti]; ok && !now.After(e) {
+		return fmt.Errorf("%w: jti is already used", ErrDPoPProof)
+	}
+
+	replayMax := v.ReplayMax
+	if replayMax <= 0 {
+		replayMax = DefaultDPoPReplayMax
+	}
+
+	if _, ok := v.seen[jti]; !ok && len(v.seen) >= replayMax {
+		return fmt.Errorf("%w: too many proofs to check the replay", ErrDPoPProof)
+	}
+
+	v.seen[jti] = expire
+
+	return nil
+}
+
+// Confirmation returns the cnf claim of the JWT without validation, nil if not exists.
+//
+// Use it after the token is validated to get the key binding like jkt and x5t#S256.
+func Confirmation(tokenString string) map[string]interface{} {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return nil
+	}
+
+	cnf, _ := claims["cnf"].(map[string]interface{})
+
+	return cnf
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/worldline-go/auth/providers"
+	"github.com/worldline-go/auth/request"
+)
+
+func TestDPoPVerifier_VerifyBound(t *testing.T) {
+	dpop, err := request.NewDPoP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherDPoP, err := request.NewDPoP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := dpop.Proof(http.MethodGet, "http://example.com/test", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var verifier DPoPVerifier
+
+	if err := verifier.VerifyBound(proof, http.MethodGet, "http://example.com/test", "token", otherDPoP.Thumbprint()); !errors.Is(err, ErrDPoPNotBound) {
+		t.Fatalf("VerifyBound() error = %v, want %v", err, ErrDPoPNotBound)
+	}
+
+	// not bound proof doesn't use the jti
+	if err := verifier.VerifyBound(proof, http.MethodGet, "http://example.com/test", "token", dpop.Thumbprint()); err != nil {
+		t.Fatalf("VerifyBound() error = %v", err)
+	}
+
+	if err := verifier.VerifyBound(proof, http.MethodGet, "http://example.com/test", "token", dpop.Thumbprint()); !errors.Is(err, ErrDPoPProof) {
+		t.Fatalf("VerifyBound() of replay error = %v, want %v", err, ErrDPoPProof)
+	}
+}
+
+func TestDPoPVerifier_ReplayMax(t *testing.T) {
+	dpop, err := request.NewDPoP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof := func(t *testing.T) string {
+		t.Helper()
+
+		v, err := dpop.Proof(http.MethodGet, "http://example.com/test", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	verifier := DPoPVerifier{ReplayMax: 2}
+
+	for i := 0; i < 2; i++ {
+		if _, err := verifier.Verify(proof(t), http.MethodGet, "http://example.com/test", ""); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+	}
+
+	// jti values are not expired, new proofs are rejected instead of dropping them
+	if _, err := verifier.Verify(proof(t), http.MethodGet, "http://example.com/test", ""); !errors.Is(err, ErrDPoPProof) {
+		t.Fatalf("Verify() at the limit error = %v, want %v", err, ErrDPoPProof)
+	}
+
+	if got := len(verifier.seen); got != 2 {
+		t.Errorf("kept jti values = %d, want 2", got)
+	}
+}
+
+func TestProvider_ValidateDPoP(t *testing.T) {
+	p := &Provider{
+		Generic: &providers.Generic{CertURL: "http://localhost/certs"},
+		DPoP:    &request.DPoPConfig{Key: "not a pem key"},
+	}
+
+	if err := p.Validate(providers.UseResourceServer); err == nil {
+		t.Fatal("Validate() with invalid dpop key, want error")
+	}
+
+	// provider is still usable without DPoP
+	if v, ok := p.ActiveProvider().(*ProviderExtra); !ok || v.dpop != nil {
+		t.Fatalf("ActiveProvider() = %v, want provider without dpop", v)
+	}
+
+	p.DPoP = &request.DPoPConfig{}
+	if err := p.Validate(providers.UseResourceServer); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+}
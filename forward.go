@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth/request"
+	"golang.org/x/oauth2"
+)
+
+// ErrAccessTokenNotFound is returned by the forward transport when the context has no access token and no fallback.
+var ErrAccessTokenNotFound = errors.New("access token not found in the context")
+
+// ErrForwardDPoPBound is returned by the forward transport for the DPoP bound access tokens without token exchange.
+//
+// Proof key of the caller is not ours, a bound token is only usable downstream after the exchange.
+var ErrForwardDPoPBound = errors.New("DPoP bound access token can't be forwarded without token exchange")
+
+// DefaultForwardExchangeTTL is the cache duration of the exchanged tokens without expiration.
+var DefaultForwardExchangeTTL = time.Minute
+
+// forwardCacheMax is the maximum count of the cached exchanged tokens.
+var forwardCacheMax = 1000
+
+type (
+	ctxAccessToken     struct{}
+	ctxAccessTokenType struct{}
+)
+
+// WithAccessToken returns a context holding the access token of the incoming request.
+//
+// authecho's JWT middleware sets it in the request context after the token is validated.
+func WithAccessToken(ctx context.Context, accessToken string) context.Context {
+	return context.WithValue(ctx, ctxAccessToken{}, accessToken)
+}
+
+// AccessTokenFromContext returns the access token of the incoming request, empty if not set.
+func AccessTokenFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(ctxAccessToken{}).(string)
+
+	return v
+}
+
+// WithAccessTokenType returns a context holding the token type of the incoming request, like DPoP.
+//
+// Forward transport refuses the DPoP tokens without token exchange.
+func WithAccessTokenType(ctx context.Context, tokenType string) context.Context {
+	return context.WithValue(ctx, ctxAccessTokenType{}, tokenType)
+}
+
+// AccessTokenTypeFromContext returns the token type of the incoming request, empty if not set.
+func AccessTokenTypeFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(ctxAccessTokenType{}).(string)
+
+	return v
+}
+
+// TokenExchangeFunc returns the token to forward for the subject token.
+type TokenExchangeFunc func(ctx context.Context, subjectToken string) (*oauth2.Token, error)
+
+// NewTokenExchangeFunc returns a function exchanging the subject token with the config, RFC 8693.
+//
+// Token type of the response is kept, nil authClient uses request.DefaultAuth.
+func NewTokenExchangeFunc(authClient *request.Auth, cfg request.TokenExchangeConfig) TokenExchangeFunc {
+	if authClient == nil {
+		authClient = request.DefaultAuth
+	}
+
+	return func(ctx context.Context, subjectToken string) (*oauth2.Token, error) {
+		exchangeCfg := cfg
+		exchangeCfg.SubjectToken = subjectToken
+
+		token, err := request.DecodeToken(authClient.TokenExchange(ctx, exchangeCfg))
+		if err != nil {
+			return nil, err
+		}
+
+		return token.OAuth2Token(), nil
+	}
+}
+
+type optionsForward struct {
+	fallback oauth2.TokenSource
+	exchange TokenExchangeFunc
+	dpop     *request.DPoP
+}
+
+type OptionForward func(*optionsForward)
+
+// WithForwardFallback sets the token source to use when the context has no access token.
+//
+// Use the Source of OAuth2Shared to call with client credentials.
+func WithForwardFallback(source oauth2.TokenSource) OptionForward {
+	return func(opts *optionsForward) {
+		opts.fallback = source
+	}
+}
+
+// WithForwardExchange exchanges the access token before forwarding, see ProviderExtra.TokenExchangeFunc.
+//
+// Exchanged tokens are cached per access token until the exchanged or the access token expires,
+// DefaultForwardExchangeTTL is used for tokens without expiration.
+func WithForwardExchange(fn TokenExchangeFunc) OptionForward {
+	return func(opts *optionsForward) {
+		opts.exchange = fn
+	}
+}
+
+// WithForwardDPoP adds DPoP proofs to the requests for the DPoP bound exchanged tokens.
+//
+// Use the DPoP of OAuth2Shared, it must be the key of the token exchange requests.
+func WithForwardDPoP(dpop *request.DPoP) OptionForward {
+	return func(opts *optionsForward) {
+		opts.dpop = dpop
+	}
+}
+
+// NewForwardRoundTripper returns a RoundTripper forwarding the access token of the request context.
+//
+// Access token is forwarded with the Bearer type, DPoP bound tokens return ErrForwardDPoPBound without WithForwardExchange.
+// Requests without an access token use the fallback, or return ErrAccessTokenNotFound.
+func NewForwardRoundTripper(transport http.RoundTripper, opts ...OptionForward) http.RoundTripper {
+	var options optionsForward
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &forwardTransport{
+		base:     dpopTransport(options.dpop, transport),
+		fallback: options.fallback,
+		exchange: options.exchange,
+		tokens:   make(map[string]*forwardToken),
+		calls:    make(map[string]*exchangeCall),
+	}
+}
+
+type forwardTransport struct {
+	base     http.RoundTripper
+	fallback oauth2.TokenSource
+	exchange TokenExchangeFunc
+
+	mutex  sync.Mutex
+	tokens map[string]*forwardToken
+	calls  map[string]*exchangeCall
+}
+
+// exchangeCall is the in-flight exchange of a subject token, done is closed with the result.
+type exchangeCall struct {
+	done     chan struct{}
+	token    *oauth2.Token
+	err      error
+	canceled bool
+}
+
+// forwardToken is the cached exchanged token.
+type forwardToken struct {
+	token  *oauth2.Token
+	expire time.Time
+}
+
+func (t *forwardToken) valid() bool {
+	return t != nil && time.Now().Add(DefaultExpireDuration).Before(t.expire)
+}
+
+func (t *forwardTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var source oauth2.TokenSource
+
+	accessToken := AccessTokenFromContext(req.Context())
+	switch {
+	case accessToken == "" && t.fallback == nil:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, ErrAccessTokenNotFound
+	case accessToken != "" && t.exchange == nil && isDPoPBound(req.Context(), accessToken):
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, ErrForwardDPoPBound
+	case accessToken == "":
+		source = t.fallback
+	case t.exchange != nil:
+		source = &exchangeTokenSource{
+			ctx:          req.Context(),
+			transport:    t,
+			subjectToken: accessToken,
+		}
+	default:
+		source = oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken: accessToken,
+			TokenType:   "Bearer",
+		})
+	}
+
+	transport := &Oauth2Transport{
+		Transport: oauth2.Transport{
+			Source: source,
+			Base:   t.base,
+		},
+	}
+
+	return transport.RoundTrip(req)
+}
+
+// isDPoPBound reports the access token is sent with the DPoP scheme or has the cnf.jkt claim.
+func isDPoPBound(ctx context.Context, accessToken string) bool {
+	if strings.EqualFold(AccessTokenTypeFromContext(ctx), request.TokenTypeDPoP) {
+		return true
+	}
+
+	jkt, _ := Confirmation(accessToken)["jkt"].(string)
+
+	return jkt != ""
+}
+
+// exchangeTokenSource returns the cached exchanged token of the subject token.
+type exchangeTokenSource struct {
+	ctx          context.Context
+	transport    *forwardTransport
+	subjectToken string
+}
+
+// Token returns the cached token or exchanges the subject token, one exchange is sent at a time for a subject token.
+//
+// Waiting calls try again with their context if the exchanging call is canceled.
+func (s *exchangeTokenSource) Token() (*oauth2.Token, error) {
+	key := request.AccessTokenHash(s.subjectToken)
+
+	for {
+		s.transport.mutex.Lock()
+		if cached := s.transport.tokens[key]; cached.valid() {
+			s.transport.mutex.Unlock()
+
+			return cached.token, nil
+		}
+
+		call := s.transport.calls[key]
+		if call == nil {
+			call = &exchangeCall{done: make(chan struct{})}
+			s.transport.calls[key] = call
+			s.transport.mutex.Unlock()
+
+			s.exchange(key, call)
+
+			return call.token, call.err
+		}
+		s.transport.mutex.Unlock()
+
+		select {
+		case <-call.done:
+			if call.canceled && s.ctx.Err() == nil {
+				continue
+			}
+
+			return call.token, call.err
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		}
+	}
+}
+
+// exchange gets the exchanged token, caches it and ends the call with the result.
+func (s *exchangeTokenSource) exchange(key string, call *exchangeCall) {
+	token, err := s.transport.exchange(s.ctx, s.subjectToken)
+
+	s.transport.mutex.Lock()
+	defer s.transport.mutex.Unlock()
+
+	delete(s.transport.calls, key)
+
+	if err == nil {
+		// exchanged token is not used after the subject token
+		expire := token.Expiry
+		if expire.IsZero() {
+			expire = time.Now().Add(DefaultForwardExchangeTTL)
+		}
+
+		if subjectExpire := tokenExpiration(s.subjectToken); !subjectExpire.IsZero() && subjectExpire.Before(expire) {
+			expire = subjectExpire
+		}
+
+		s.transport.store(key, &forwardToken{token: token, expire: expire})
+	}
+
+	call.token, call.err, call.canceled = token, err, err != nil && s.ctx.Err() != nil
+	close(call.done)
+}
+
+// Invalidate drops the exchanged token, next request exchanges again.
+func (s *exchangeTokenSource) Invalidate(token *oauth2.Token) {
+	key := request.AccessTokenHash(s.subjectToken)
+
+	s.transport.mutex.Lock()
+	defer s.transport.mutex.Unlock()
+
+	if v := s.transport.tokens[key]; v != nil && token != nil && v.token.AccessToken == token.AccessToken {
+		delete(s.transport.tokens, key)
+	}
+}
+
+// store adds the token to the cache, expired tokens and then the earliest expiring token are removed at the limit.
+func (t *forwardTransport) store(key string, token *forwardToken) {
+	if _, ok := t.tokens[key]; !ok && len(t.tokens) >= forwardCacheMax {
+		var oldestKey string
+		var oldest *forwardToken
+
+		for k, v := range t.tokens {
+			if !v.valid() {
+				delete(t.tokens, k)
+
+				continue
+			}
+
+			if oldest == nil || v.expire.Before(oldest.expire) {
+				oldestKey, oldest = k, v
+			}
+		}
+
+		if len(t.tokens) >= forwardCacheMax {
+			delete(t.tokens, oldestKey)
+		}
+	}
+
+	t.tokens[key] = token
+}
+
+// tokenExpiration returns the exp claim of the JWT, zero if not a JWT or without expiration.
+func tokenExpiration(accessToken string) time.Time {
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, &claims); err != nil || claims.ExpiresAt == nil {
+		return time.Time{}
+	}
+
+	return claims.ExpiresAt.Time
+}
+
+// TokenExchangeFunc returns a function exchanging the subject token with the provider's client, RFC 8693.
+//
+// Empty TokenURL of the config uses the provider's token URL and client authentication.
+func (p *ProviderExtra) TokenExchangeFunc(cfg request.TokenExchangeConfig) TokenExchangeFunc {
+	return func(ctx context.Context, subjectToken string) (*oauth2.Token, error) {
+		if cfg.TokenURL != "" {
+			return NewTokenExchangeFunc(p.AuthClient(), cfg)(ctx, subjectToken)
+		}
+
+		authClient, authRequestConfig, err := p.authRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		exchangeCfg := cfg
+		authRequestConfig.Scopes = exchangeCfg.Scopes
+		exchangeCfg.AuthRequestConfig = authRequestConfig
+
+		return NewTokenExchangeFunc(authClient, exchangeCfg)(ctx, subjectToken)
+	}
+}
+
+// authRequest returns the client and config of the provider's client authentication to use in the request flows.
+func (p *ProviderExtra) authRequest() (*request.Auth, request.AuthRequestConfig, error) {
+	clientAuth, err := p.ClientAuth()
+	if err != nil {
+		return nil, request.AuthRequestConfig{}, err
+	}
+
+	client := p.client
+
+	// assertion is set by the request, only certificate needed in client
+	if clientAuth.Method == request.AuthMethodTLSClientAuth {
+		client, err = p.certClients.HTTPClient(clientAuth, client)
+		if err != nil {
+			return nil, request.AuthRequestConfig{}, err
+		}
+	}
+
+	return &request.Auth{Client: client, DPoP: p.dpop}, clientAuth.AuthRequestConfig(p.GetTokenURL()), nil
+}
@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+func TestNewForwardRoundTripper(t *testing.T) {
+	serverAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// first exchanged token is revoked
+		if r.Header.Get("Authorization") == "Bearer exchanged-user-token-1" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer serverAPI.Close()
+
+	var exchanges int32
+	exchange := func(_ context.Context, subjectToken string) (*oauth2.Token, error) {
+		count := atomic.AddInt32(&exchanges, 1)
+
+		return &oauth2.Token{
+			AccessToken: fmt.Sprintf("exchanged-%s-%d", subjectToken, count),
+			TokenType:   "Bearer",
+			Expiry:      time.Now().Add(time.Hour),
+		}, nil
+	}
+
+	fallback := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "client-token"})
+
+	boundToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"cnf": map[string]interface{}{"jkt": "thumbprint"},
+	}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		opts          []OptionForward
+		accessToken   string
+		tokenType     string
+		want          string
+		wantErr       error
+		wantExchanges int32
+	}{
+		{
+			name:        "forward",
+			accessToken: "user-token",
+			want:        "Bearer user-token",
+		},
+		{
+			name:        "forward dpop",
+			accessToken: "user-token",
+			tokenType:   "DPoP",
+			wantErr:     ErrForwardDPoPBound,
+		},
+		{
+			name:        "forward bound token",
+			accessToken: boundToken,
+			wantErr:     ErrForwardDPoPBound,
+		},
+		{
+			name:          "exchange dpop",
+			opts:          []OptionForward{WithForwardExchange(exchange)},
+			accessToken:   "user-token",
+			tokenType:     "DPoP",
+			want:          "Bearer exchanged-user-token-2",
+			wantExchanges: 2,
+		},
+		{
+			name:    "no token",
+			wantErr: ErrAccessTokenNotFound,
+		},
+		{
+			name: "fallback",
+			opts: []OptionForward{WithForwardFallback(fallback)},
+			want: "Bearer client-token",
+		},
+		{
+			name:          "exchange",
+			opts:          []OptionForward{WithForwardFallback(fallback), WithForwardExchange(exchange)},
+			accessToken:   "user-token",
+			want:          "Bearer exchanged-user-token-2",
+			wantExchanges: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&exchanges, 0)
+
+			client := &http.Client{Transport: NewForwardRoundTripper(http.DefaultTransport, tt.opts...)}
+
+			// second request uses the cached exchanged token
+			for i := 0; i < 2; i++ {
+				ctx := context.Background()
+				if tt.accessToken != "" {
+					ctx = WithAccessToken(ctx, tt.accessToken)
+				}
+
+				if tt.tokenType != "" {
+					ctx = WithAccessTokenType(ctx, tt.tokenType)
+				}
+
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, serverAPI.URL, nil)
+				resp, err := client.Do(req)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Do() error = %v, want %v", err, tt.wantErr)
+					}
+
+					return
+				}
+
+				if err != nil {
+					t.Fatalf("Do() error = %v", err)
+				}
+
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+
+				if string(body) != tt.want {
+					t.Errorf("Authorization = %q, want %q", body, tt.want)
+				}
+			}
+
+			if got := atomic.LoadInt32(&exchanges); got != tt.wantExchanges {
+				t.Errorf("exchanges = %d, want %d", got, tt.wantExchanges)
+			}
+		})
+	}
+}
+
+func TestNewForwardRoundTripper_ExchangeCache(t *testing.T) {
+	serverAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer serverAPI.Close()
+
+	subject := func(exp time.Duration) string {
+		v, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+		}).SignedString([]byte("test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	tests := []struct {
+		name          string
+		subjectToken  string
+		expiry        time.Duration
+		tokenType     string
+		want          string
+		wantExchanges int32
+	}{
+		{
+			name:          "cached",
+			subjectToken:  subject(time.Hour),
+			expiry:        time.Hour,
+			want:          "Bearer exchanged",
+			wantExchanges: 1,
+		},
+		{
+			name:          "subject expires first",
+			subjectToken:  subject(5 * time.Second),
+			expiry:        time.Hour,
+			want:          "Bearer exchanged",
+			wantExchanges: 2,
+		},
+		{
+			name:          "no expiry",
+			subjectToken:  "opaque",
+			want:          "Bearer exchanged",
+			wantExchanges: 1,
+		},
+		{
+			name:          "token type",
+			subjectToken:  "opaque",
+			expiry:        time.Hour,
+			tokenType:     "DPoP",
+			want:          "DPoP exchanged",
+			wantExchanges: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var exchanges int32
+			exchange := func(_ context.Context, _ string) (*oauth2.Token, error) {
+				atomic.AddInt32(&exchanges, 1)
+
+				token := &oauth2.Token{
+					AccessToken: "exchanged",
+					TokenType:   tt.tokenType,
+				}
+
+				if tt.expiry > 0 {
+					token.Expiry = time.Now().Add(tt.expiry)
+				}
+
+				return token, nil
+			}
+
+			client := &http.Client{Transport: NewForwardRoundTripper(http.DefaultTransport, WithForwardExchange(exchange))}
+
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequestWithContext(WithAccessToken(context.Background(), tt.subjectToken), http.MethodGet, serverAPI.URL, nil)
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatalf("Do() error = %v", err)
+				}
+
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+
+				if string(body) != tt.want {
+					t.Errorf("Authorization = %q, want %q", body, tt.want)
+				}
+			}
+
+			if got := atomic.LoadInt32(&exchanges); got != tt.wantExchanges {
+				t.Errorf("exchanges = %d, want %d", got, tt.wantExchanges)
+			}
+		})
+	}
+}
+
+func TestNewForwardRoundTripper_ExchangeCacheMax(t *testing.T) {
+	defer func(v int) { forwardCacheMax = v }(forwardCacheMax)
+	forwardCacheMax = 2
+
+	transport := NewForwardRoundTripper(http.DefaultTransport, WithForwardExchange(func(_ context.Context, subjectToken string) (*oauth2.Token, error) {
+		return &oauth2.Token{AccessToken: "exchanged-" + subjectToken, Expiry: time.Now().Add(time.Hour)}, nil
+	})).(*forwardTransport)
+
+	for _, subjectToken := range []string{"user-1", "user-2", "user-3"} {
+		source := &exchangeTokenSource{ctx: context.Background(), transport: transport, subjectToken: subjectToken}
+		if _, err := source.Token(); err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+	}
+
+	if got := len(transport.tokens); got != 2 {
+		t.Errorf("cached tokens = %d, want 2", got)
+	}
+}
+
+func TestNewForwardRoundTripper_ExchangeSingleFlight(t *testing.T) {
+	var exchanges int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	transport := NewForwardRoundTripper(http.DefaultTransport, WithForwardExchange(func(ctx context.Context, subjectToken string) (*oauth2.Token, error) {
+		if atomic.AddInt32(&exchanges, 1) == 1 {
+			close(started)
+		}
+
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		return &oauth2.Token{AccessToken: "exchanged-" + subjectToken, Expiry: time.Now().Add(time.Hour)}, nil
+	})).(*forwardTransport)
+
+	token := func(ctx context.Context) (*oauth2.Token, error) {
+		source := &exchangeTokenSource{ctx: ctx, transport: transport, subjectToken: "user"}
+
+		return source.Token()
+	}
+
+	// first call is canceled, waiting calls exchange again with their context
+	ctx, cancel := context.WithCancel(context.Background())
+	errFirst := make(chan error, 1)
+	go func() {
+		_, err := token(ctx)
+		errFirst <- err
+	}()
+
+	<-started
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			v, err := token(context.Background())
+			if err == nil && v.AccessToken != "exchanged-user" {
+				err = fmt.Errorf("token = %q", v.AccessToken)
+			}
+
+			results <- err
+		}()
+	}
+
+	cancel()
+	if err := <-errFirst; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Token() of canceled call error = %v, want %v", err, context.Canceled)
+	}
+
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("Token() error = %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&exchanges); got != 2 {
+		t.Errorf("exchanges = %d, want 2", got)
+	}
+}
@@ -23,9 +23,13 @@ type IntrospectJWTKey struct {
 	URL          string
 	ClientID     string
 	ClientSecret string
+	// ClientAuth is optional, if set it is used in every check instead of ClientID and ClientSecret.
+	ClientAuth func() (*request.ClientAuth, error)
 
 	Client *http.Client
 	Ctx    context.Context
+
+	certClients *certClientCache
 }
 
 func (IntrospectJWTKey) Keyfunc(token *jwt.Token) (interface{}, error) {
@@ -60,6 +64,17 @@ func (i IntrospectJWTKey) CheckIntrospect(token string) error {
 		"token_type_hint": {"access_token"},
 	}
 
+	if i.ClientAuth != nil {
+		clientAuth, err := i.ClientAuth()
+		if err != nil {
+			return err
+		}
+
+		if clientAuth != nil {
+			return i.checkIntrospectClientAuth(client, clientAuth, uValues)
+		}
+	}
+
 	encodedData := uValues.Encode()
 
 	req, err := http.NewRequestWithContext(i.Ctx, http.MethodPost, i.URL, strings.NewReader(encodedData))
@@ -84,6 +99,32 @@ func (i IntrospectJWTKey) CheckIntrospect(token string) error {
 		return err
 	}
 
+	return checkIntrospectResponse(v)
+}
+
+func (i IntrospectJWTKey) checkIntrospectClientAuth(client *http.Client, clientAuth *request.ClientAuth, uValues url.Values) error {
+	// assertion is set by the request, only certificate needed in client
+	if clientAuth.Method == request.AuthMethodTLSClientAuth {
+		var err error
+		client, err = i.certClients.HTTPClient(clientAuth, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	authClient := request.Auth{
+		Client: client,
+	}
+
+	v, err := authClient.AuthRequest(i.Ctx, uValues, clientAuth.AuthRequestConfig(i.URL))
+	if err != nil {
+		return err
+	}
+
+	return checkIntrospectResponse(v)
+}
+
+func checkIntrospectResponse(v []byte) error {
 	var restIntrospect RestIntrospect
 	if err := json.Unmarshal(v, &restIntrospect); err != nil {
 		return err
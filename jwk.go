@@ -2,21 +2,50 @@ package auth
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/MicahParks/keyfunc/v2"
 	"github.com/worldline-go/auth/models"
+	"github.com/worldline-go/auth/request"
 )
 
 type ProviderExtra struct {
 	InfProvider
 
-	noop bool
+	noop        bool
+	client      *http.Client
+	dpop        *request.DPoP
+	certClients *certClientCache
 }
 
 func (p *ProviderExtra) IsNoop() bool {
 	return p.noop
 }
 
+// HTTPClient returns the client of the provider's policy, default is http.DefaultClient.
+//
+// Requests have DPoP proofs if DPoP is enabled.
+func (p *ProviderExtra) HTTPClient() *http.Client {
+	client := p.client
+	if p.dpop != nil {
+		return p.dpop.Client(client)
+	}
+
+	if client == nil {
+		return http.DefaultClient
+	}
+
+	return client
+}
+
+// AuthClient returns the request client with the provider's policy and DPoP to use in the request flows.
+func (p *ProviderExtra) AuthClient() *request.Auth {
+	return &request.Auth{
+		Client: p.client,
+		DPoP:   p.dpop,
+	}
+}
+
 // JWTKeyFunc returns a jwt.Keyfunc.
 //
 // Need GetCertURL in provider.
@@ -25,13 +54,23 @@ func (p *ProviderExtra) IsNoop() bool {
 // Use Parser function for introspect, not keyfunc.
 func (p *ProviderExtra) JWTKeyFunc(opts ...OptionJWK) (models.InfKeyFuncParser, error) {
 	option := GetOptionJWK(opts...)
+	if option.Client == nil {
+		option.Client = p.client
+	}
 
 	if option.Introspect {
+		if _, err := p.ClientAuth(); err != nil {
+			return nil, err
+		}
+
 		return &IntrospectJWTKey{
 			URL:          p.GetIntrospectURL(),
 			ClientID:     p.GetClientID(),
 			ClientSecret: p.GetClientSecret(),
+			ClientAuth:   p.ClientAuth,
+			Client:       option.Client,
 			Ctx:          option.Ctx,
+			certClients:  p.certClients,
 		}, nil
 	}
 
@@ -43,6 +43,8 @@ type optionsJWK struct {
 	Ctx                 context.Context
 	Introspect          bool
 	KeyFunc             models.InfKeyFunc
+	RealmIdleTimeout    time.Duration
+	RealmMax            int
 }
 
 type OptionJWK func(options *optionsJWK)
@@ -97,3 +99,21 @@ func WithContext(ctx context.Context) OptionJWK {
 		options.Ctx = ctx
 	}
 }
+
+// WithRealmIdleTimeout sets the duration to keep an unused realm's JWKS in MultiRealmJWTKeyFunc.
+//
+// Default is DefaultRealmIdleTimeout.
+func WithRealmIdleTimeout(d time.Duration) OptionJWK {
+	return func(options *optionsJWK) {
+		options.RealmIdleTimeout = d
+	}
+}
+
+// WithRealmMax sets the number of realms to keep at the same time in MultiRealmJWTKeyFunc.
+//
+// Least recently used realm is removed to add a new one, default is DefaultRealmMax.
+func WithRealmMax(n int) OptionJWK {
+	return func(options *optionsJWK) {
+		options.RealmMax = n
+	}
+}
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultRealmIdleTimeout is the default duration to keep an unused realm's JWKS.
+var DefaultRealmIdleTimeout = 30 * time.Minute
+
+// DefaultRealmFailureTTL is the duration to return the cached error of a failed JWKS fetch before trying again.
+var DefaultRealmFailureTTL = 10 * time.Second
+
+// DefaultRealmMax is the default number of realms to keep at the same time.
+var DefaultRealmMax = 100
+
+type InfProviderRealm interface {
+	GetCertURLRealm(realm string) (string, error)
+	GetRealmFromIssuer(issuer string) (string, error)
+	GetRealmAllow() string
+}
+
+type realmJWKS struct {
+	once     sync.Once
+	ready    chan struct{}
+	jwks     *keyfunc.JWKS
+	err      error
+	retryAt  time.Time
+	lastUsed time.Time
+}
+
+// done reports if the fetch is finished, fields set in once are readable after it.
+func (v *realmJWKS) done() bool {
+	select {
+	case <-v.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// KeyFuncRealm selects the JWKS with the realm of the token's issuer.
+//
+// JWKS of the realms are created when first needed and removed after idle timeout.
+type KeyFuncRealm struct {
+	provider InfProviderRealm
+	keyOpts  keyfunc.Options
+	idle     time.Duration
+	max      int
+
+	realms map[string]*realmJWKS
+	m      sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// MultiRealmJWTKeyFunc returns a key function for multiple realms, like realm-per-tenant usage of keycloak.
+//
+// Realm is taken from the unverified "iss" claim and checked by the provider before to get JWKS,
+// provider's RealmAllow is required.
+//
+// Doesn't support introspect and given keys, it will ignore them.
+func MultiRealmJWTKeyFunc(provider InfProviderRealm, opts ...OptionJWK) (*KeyFuncRealm, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("provider is required")
+	}
+
+	if provider.GetRealmAllow() == "" {
+		return nil, fmt.Errorf("realm_allow is required for multiple realms")
+	}
+
+	opt := GetOptionJWK(opts...)
+
+	idle := opt.RealmIdleTimeout
+	if idle <= 0 {
+		idle = DefaultRealmIdleTimeout
+	}
+
+	realmMax := opt.RealmMax
+	if realmMax <= 0 {
+		realmMax = DefaultRealmMax
+	}
+
+	ctx, cancel := context.WithCancel(opt.Ctx)
+
+	k := &KeyFuncRealm{
+		provider: provider,
+		keyOpts:  MapOptionKeyfunc(opt),
+		idle:     idle,
+		max:      realmMax,
+		realms:   make(map[string]*realmJWKS),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	go k.evictLoop()
+
+	return k, nil
+}
+
+func (k *KeyFuncRealm) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Claims == nil {
+		return nil, fmt.Errorf("claims not found")
+	}
+
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get issuer: %w", err)
+	}
+
+	realm, err := k.provider.GetRealmFromIssuer(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks, err := k.getJWKS(realm)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwks.Keyfunc(token)
+}
+
+func (k *KeyFuncRealm) ParseWithClaims(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return (&JwkKeyFuncParse{KeyFunc: k.Keyfunc}).ParseWithClaims(tokenString, claims)
+}
+
+// EndBackground stops the eviction and the refresh of all JWKS.
+func (k *KeyFuncRealm) EndBackground() {
+	k.cancel()
+}
+
+func (k *KeyFuncRealm) getJWKS(realm string) (*keyfunc.JWKS, error) {
+	k.m.Lock()
+	if k.ctx.Err() != nil {
+		k.m.Unlock()
+
+		return nil, fmt.Errorf("key function closed: %w", k.ctx.Err())
+	}
+
+	now := time.Now()
+
+	v, ok := k.realms[realm]
+	if ok && v.done() && v.err != nil && !now.Before(v.retryAt) {
+		delete(k.realms, realm)
+		ok = false
+	}
+
+	if !ok {
+		if len(k.realms) >= k.max && !k.evictOne() {
+			k.m.Unlock()
+
+			return nil, fmt.Errorf("too many realms in use, max %d", k.max)
+		}
+
+		v = &realmJWKS{ready: make(chan struct{})}
+		k.realms[realm] = v
+	}
+	v.lastUsed = now
+	k.m.Unlock()
+
+	v.once.Do(func() {
+		defer close(v.ready)
+
+		certURL, err := k.provider.GetCertURLRealm(realm)
+		if err != nil {
+			v.err = err
+		} else {
+			keyOpts := k.keyOpts
+			keyOpts.Ctx = k.ctx
+
+			v.jwks, err = keyfunc.Get(certURL, keyOpts)
+			if err != nil {
+				v.err = fmt.Errorf("failed to get the JWKs from the given URL: %s; %w", certURL, err)
+			}
+		}
+
+		// failure is cached shortly to not hit the provider on every token
+		if v.err != nil {
+			v.retryAt = time.Now().Add(DefaultRealmFailureTTL)
+		}
+	})
+
+	if v.err != nil {
+		return nil, v.err
+	}
+
+	return v.jwks, nil
+}
+
+func (k *KeyFuncRealm) evictLoop() {
+	ticker := time.NewTicker(k.idle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.ctx.Done():
+			k.evict(time.Time{})
+
+			return
+		case <-ticker.C:
+			k.evict(time.Now().Add(-k.idle))
+		}
+	}
+}
+
+// evictOne removes a failed realm or the least recently used one, false if all are fetching.
+//
+// Must be called with the lock.
+func (k *KeyFuncRealm) evictOne() bool {
+	var (
+		oldestRealm string
+		oldest      *realmJWKS
+	)
+
+	for realm, v := range k.realms {
+		if !v.done() {
+			continue
+		}
+
+		if v.err != nil {
+			delete(k.realms, realm)
+
+			return true
+		}
+
+		if oldest == nil || v.lastUsed.Before(oldest.lastUsed) {
+			oldestRealm, oldest = realm, v
+		}
+	}
+
+	if oldest == nil {
+		return false
+	}
+
+	delete(k.realms, oldestRealm)
+	oldest.jwks.EndBackground()
+
+	return true
+}
+
+// evict removes realms not used after the given time, zero time removes all.
+func (k *KeyFuncRealm) evict(before time.Time) {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	for realm, v := range k.realms {
+		if !before.IsZero() && v.lastUsed.After(before) {
+			continue
+		}
+
+		if !v.done() {
+			// still fetching, in use
+			continue
+		}
+
+		delete(k.realms, realm)
+
+		if v.jwks != nil {
+			v.jwks.EndBackground()
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth/providers"
+)
+
+// realmServer serves the same JWKS for every realm, realms starting with "tenant-9" fail.
+type realmServer struct {
+	*httptest.Server
+
+	key   *rsa.PrivateKey
+	mutex sync.Mutex
+	calls map[string]int
+}
+
+func newRealmServer(t *testing.T) *realmServer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &realmServer{key: key, calls: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm := strings.TrimPrefix(r.URL.Path, "/realms/")
+		realm = strings.TrimSuffix(realm, "/protocol/openid-connect/certs")
+
+		s.mutex.Lock()
+		s.calls[realm]++
+		s.mutex.Unlock()
+
+		if strings.HasPrefix(realm, "tenant-9") {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *realmServer) Calls(realm string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.calls[realm]
+}
+
+func (s *realmServer) Token(t *testing.T, realm string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    s.URL + "/realms/" + realm,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	token.Header["kid"] = "test"
+
+	v, err := token.SignedString(s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func (k *KeyFuncRealm) realmCount() int {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	return len(k.realms)
+}
+
+func TestMultiRealmJWTKeyFunc(t *testing.T) {
+	server := newRealmServer(t)
+
+	if _, err := MultiRealmJWTKeyFunc(&providers.KeyCloak{BaseURL: server.URL}); err == nil {
+		t.Fatal("MultiRealmJWTKeyFunc() without realm_allow, want error")
+	}
+
+	k, err := MultiRealmJWTKeyFunc(&providers.KeyCloak{
+		BaseURL:    server.URL,
+		RealmAllow: "tenant-[0-9]+",
+	}, WithRealmIdleTimeout(time.Hour), WithRealmMax(2))
+	if err != nil {
+		t.Fatalf("MultiRealmJWTKeyFunc() error = %v", err)
+	}
+	defer k.EndBackground()
+
+	parse := func(realm string) error {
+		_, err := k.ParseWithClaims(server.Token(t, realm), &jwt.RegisteredClaims{})
+
+		return err
+	}
+
+	t.Run("lazy", func(t *testing.T) {
+		if got := server.Calls("tenant-1"); got != 0 {
+			t.Fatalf("JWKS fetched before use, calls = %d", got)
+		}
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if err := parse("tenant-1"); err != nil {
+				t.Fatalf("ParseWithClaims() error = %v", err)
+			}
+		}
+
+		if got := server.Calls("tenant-1"); got != 1 {
+			t.Errorf("JWKS calls = %d, want 1", got)
+		}
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		if err := parse("master"); err == nil {
+			t.Fatal("ParseWithClaims() of not allowed realm, want error")
+		}
+
+		if got := server.Calls("master"); got != 0 {
+			t.Errorf("JWKS of not allowed realm fetched, calls = %d", got)
+		}
+	})
+
+	t.Run("failure cached", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if err := parse("tenant-9"); err == nil {
+				t.Fatal("ParseWithClaims() of failing realm, want error")
+			}
+		}
+
+		if got := server.Calls("tenant-9"); got != 1 {
+			t.Errorf("JWKS calls of failing realm = %d, want 1", got)
+		}
+	})
+
+	t.Run("max realms", func(t *testing.T) {
+		// failed realm is removed first, then the least recently used
+		for _, realm := range []string{"tenant-2", "tenant-3", "tenant-1"} {
+			if err := parse(realm); err != nil {
+				t.Fatalf("ParseWithClaims() error = %v", err)
+			}
+		}
+
+		if got := k.realmCount(); got != 2 {
+			t.Errorf("realms = %d, want 2", got)
+		}
+
+		if got := server.Calls("tenant-1"); got != 2 {
+			t.Errorf("JWKS calls of evicted realm = %d, want 2", got)
+		}
+	})
+
+	t.Run("end background", func(t *testing.T) {
+		k.EndBackground()
+
+		if err := parse("tenant-1"); err == nil {
+			t.Fatal("ParseWithClaims() after EndBackground, want error")
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for k.realmCount() != 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("realms = %d after EndBackground, want 0", k.realmCount())
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestMultiRealmJWTKeyFunc_Idle(t *testing.T) {
+	server := newRealmServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	k, err := MultiRealmJWTKeyFunc(&providers.KeyCloak{
+		BaseURL:    server.URL,
+		RealmAllow: "tenant-[0-9]+",
+	}, WithContext(ctx), WithRealmIdleTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("MultiRealmJWTKeyFunc() error = %v", err)
+	}
+	defer k.EndBackground()
+
+	if _, err := k.ParseWithClaims(server.Token(t, "tenant-1"), &jwt.RegisteredClaims{}); err != nil {
+		t.Fatalf("ParseWithClaims() error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for k.realmCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle realm not evicted")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := k.ParseWithClaims(server.Token(t, "tenant-1"), &jwt.RegisteredClaims{}); err != nil {
+		t.Fatalf("ParseWithClaims() error = %v", err)
+	}
+
+	if got := server.Calls("tenant-1"); got != 2 {
+		t.Errorf("JWKS calls after eviction = %d, want 2", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth/request"
 )
 
 var defaultParser = jwt.NewParser()
@@ -146,3 +147,11 @@ func (t *JWT) Renew(tokenStr string, expDate int64) (string, error) {
 func ParseUnverified(tokenString string, claims jwt.Claims) (*jwt.Token, []string, error) {
 	return defaultParser.ParseUnverified(tokenString, claims)
 }
+
+// ClientAssertion returns a function to sign client assertions for private_key_jwt, RFC 7523.
+//
+// Assertion is signed with the JWT's method, key and kid, see request.NewClientAssertion.
+// Use it in any flow with request.AuthRequestConfig.ClientAssertion.
+func (t *JWT) ClientAssertion() request.ClientAssertionFunc {
+	return request.NewClientAssertion(t.method, t.secret, t.kid)
+}
@@ -98,3 +98,46 @@ func TestJWT_Generate(t *testing.T) {
 		})
 	}
 }
+
+func TestJWT_ClientAssertion(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewJWT(
+		WithRSAPrivateKey(key),
+		WithMethod(jwt.SigningMethodRS256),
+		WithKID("assertion"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertion, err := signer.ClientAssertion()("my-client", "http://localhost/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.RegisteredClaims{}
+	token, err := signer.Parse(assertion, &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Header["kid"] != "assertion" {
+		t.Errorf("kid = %v", token.Header["kid"])
+	}
+
+	if claims.Issuer != "my-client" || claims.Subject != "my-client" {
+		t.Errorf("iss = %v, sub = %v", claims.Issuer, claims.Subject)
+	}
+
+	if len(claims.Audience) != 1 || claims.Audience[0] != "http://localhost/token" {
+		t.Errorf("aud = %v", claims.Audience)
+	}
+
+	if claims.ID == "" || claims.ExpiresAt == nil || claims.ExpiresAt.After(time.Now().Add(2*time.Minute)) {
+		t.Errorf("jti = %v, exp = %v", claims.ID, claims.ExpiresAt)
+	}
+}
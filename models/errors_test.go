@@ -0,0 +1,38 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	errNotFound := errors.New("not found")
+
+	var err error = Errors{
+		fmt.Errorf("first: %w", errNotFound),
+		fmt.Errorf("second: %w", &os.PathError{Op: "open", Path: "file", Err: os.ErrNotExist}),
+	}
+
+	if !errors.Is(err, errNotFound) {
+		t.Errorf("errors.Is() = false, want true")
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("errors.Is() of nested error = false, want true")
+	}
+
+	if errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("errors.Is() of other error = true, want false")
+	}
+
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "file" {
+		t.Errorf("errors.As() = %v, want the path error", pathErr)
+	}
+
+	if err := (Errors{}).Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
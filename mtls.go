@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ConfirmationX5TS256 is the cnf member of the certificate bound tokens, RFC 8705 section 3.1.
+const ConfirmationX5TS256 = "x5t#S256"
+
+var (
+	// ErrTokenNotCertificateBound is returned when the token has no certificate thumbprint in cnf.
+	ErrTokenNotCertificateBound = errors.New("token is not certificate bound")
+	// ErrCertificateNotFound is returned when the token is certificate bound but no client certificate is sent.
+	ErrCertificateNotFound = errors.New("client certificate not found")
+	// ErrCertificateMismatch is returned when the client certificate is not the one the token bound to.
+	ErrCertificateMismatch = errors.New("client certificate does not match the token binding")
+)
+
+// CertificateThumbprint returns the base64url SHA-256 thumbprint of the DER encoded certificate.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCertificateBinding compares the token's cnf.x5t#S256 with the thumbprint of the client certificate.
+//
+// Use it after the token is validated.
+// Returns ErrTokenNotCertificateBound, ErrCertificateNotFound or ErrCertificateMismatch.
+func VerifyCertificateBinding(tokenString string, cert *x509.Certificate) error {
+	x5t, _ := Confirmation(tokenString)[ConfirmationX5TS256].(string)
+	if x5t == "" {
+		return ErrTokenNotCertificateBound
+	}
+
+	if cert == nil {
+		return ErrCertificateNotFound
+	}
+
+	if subtle.ConstantTimeCompare([]byte(x5t), []byte(CertificateThumbprint(cert))) != 1 {
+		return ErrCertificateMismatch
+	}
+
+	return nil
+}
+
+// ParseForwardedCertificate parses the client certificate forwarded by a proxy in a header.
+//
+// Value can be PEM, URL-encoded PEM like nginx's $ssl_client_escaped_cert or base64 DER.
+func ParseForwardedCertificate(v string) (*x509.Certificate, error) {
+	if strings.Contains(v, "%") {
+		unescaped, err := url.PathUnescape(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unescape certificate: %w", err)
+		}
+
+		v = unescaped
+	}
+
+	var der []byte
+	if block, _ := pem.Decode([]byte(v)); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		der, err = base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode certificate: %w", err)
+		}
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return cert, nil
+}
@@ -2,17 +2,38 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/worldline-go/auth/models"
+	"github.com/worldline-go/auth/providers"
+	"github.com/worldline-go/auth/redirect"
+	"github.com/worldline-go/auth/request"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
 const NoopKey = "noop"
 
-type Noop struct{}
+// NoopDevModeEnv is the environment variable to allow noop provider with WithNoopGuard.
+var NoopDevModeEnv = "AUTH_NOOP_DEV_MODE"
+
+// NoopAllowed reports the NoopDevModeEnv environment variable is set to true.
+func NoopAllowed() bool {
+	v, _ := strconv.ParseBool(os.Getenv(NoopDevModeEnv))
+
+	return v
+}
+
+// Noop provider disables the authentication, use only for local development and tests.
+type Noop struct {
+	// Identity is used as claims when no token is sent, optional.
+	Identity *providers.Noop
+}
 
 func (Noop) GetLogoutURL() string {
 	return NoopKey
@@ -22,6 +43,26 @@ func (Noop) GetLogoutURLExternal() string {
 	return NoopKey
 }
 
+func (Noop) GetUserInfoURL() string {
+	return NoopKey
+}
+
+func (Noop) GetUserInfoURLExternal() string {
+	return NoopKey
+}
+
+func (Noop) GetRevocationURL() string {
+	return NoopKey
+}
+
+func (Noop) GetDeviceAuthURL() string {
+	return NoopKey
+}
+
+func (Noop) GetPARURL() string {
+	return NoopKey
+}
+
 func (Noop) GetIntrospectURL() string {
 	return NoopKey
 }
@@ -34,6 +75,14 @@ func (Noop) ClientConfig() (*clientcredentials.Config, error) {
 	return nil, nil
 }
 
+func (Noop) ClientAuth() (*request.ClientAuth, error) {
+	return nil, nil
+}
+
+func (Noop) GetTokenEndpointAuthMethod() string {
+	return NoopKey
+}
+
 func (Noop) GetCertURL() string {
 	return NoopKey
 }
@@ -70,14 +119,26 @@ func (Noop) GetClientSecretExternal() string {
 	return NoopKey
 }
 
-func (Noop) JWTKeyFunc(opts ...OptionJWK) (models.InfKeyFuncParser, error) {
-	return NoopJWTKey{}, nil
+func (n Noop) JWTKeyFunc(opts ...OptionJWK) (models.InfKeyFuncParser, error) {
+	return NoopJWTKey{Identity: n.Identity}, nil
+}
+
+func (Noop) Validate(_ ...providers.Use) error {
+	return nil
 }
 
 func (Noop) IsNoop() bool {
 	return true
 }
 
+func (Noop) HTTPClient() *http.Client {
+	return http.DefaultClient
+}
+
+func (Noop) AuthClient() *request.Auth {
+	return request.DefaultAuth
+}
+
 func (Noop) RoundTripper(_ context.Context, transport http.RoundTripper) (http.RoundTripper, error) {
 	return transport, nil
 }
@@ -92,7 +153,26 @@ func (Noop) NewOauth2Shared(_ context.Context) (*OAuth2Shared, error) {
 	return &OAuth2Shared{}, nil
 }
 
-type NoopJWTKey struct{}
+func (Noop) NewOauth2SharedUser(_ context.Context, _ ...OptionUserToken) (*OAuth2Shared, error) {
+	return &OAuth2Shared{}, nil
+}
+
+// SetRedirect does nothing, noop has no redirection.
+func (Noop) SetRedirect(_ *redirect.Setting) {}
+
+// TokenExchangeFunc returns the subject token as-is.
+func (Noop) TokenExchangeFunc(_ request.TokenExchangeConfig) TokenExchangeFunc {
+	return func(_ context.Context, subjectToken string) (*oauth2.Token, error) {
+		return &oauth2.Token{
+			AccessToken: subjectToken,
+			TokenType:   "Bearer",
+		}, nil
+	}
+}
+
+type NoopJWTKey struct {
+	Identity *providers.Noop
+}
 
 func (NoopJWTKey) Keyfunc(_ *jwt.Token) (interface{}, error) {
 	return NoopKey, nil
@@ -100,7 +180,14 @@ func (NoopJWTKey) Keyfunc(_ *jwt.Token) (interface{}, error) {
 
 func (NoopJWTKey) EndBackground() {}
 
+// ParseWithClaims parses the token without verification.
+//
+// Empty or NoopKey token returns the identity as claims.
 func (n NoopJWTKey) ParseWithClaims(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	if tokenString == "" || tokenString == NoopKey {
+		return NoopToken(n.Identity, claims)
+	}
+
 	token, _, err := jwt.NewParser().ParseUnverified(tokenString, claims)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse the JWT: %w", err)
@@ -108,3 +195,28 @@ func (n NoopJWTKey) ParseWithClaims(tokenString string, claims jwt.Claims) (*jwt
 
 	return token, nil
 }
+
+// NoopToken returns a valid token with the identity claims, identity could be nil.
+func NoopToken(identity *providers.Noop, claims jwt.Claims) (*jwt.Token, error) {
+	mapClaims := map[string]interface{}{}
+	if identity != nil {
+		mapClaims = identity.MapClaims()
+	}
+
+	v, err := json.Marshal(mapClaims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal noop identity: %w", err)
+	}
+
+	if err := json.Unmarshal(v, claims); err != nil {
+		return nil, fmt.Errorf("failed to set noop identity: %w", err)
+	}
+
+	return &jwt.Token{
+		Raw:    NoopKey,
+		Method: jwt.SigningMethodNone,
+		Header: map[string]interface{}{"alg": jwt.SigningMethodNone.Alg()},
+		Claims: claims,
+		Valid:  true,
+	}, nil
+}
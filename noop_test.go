@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/worldline-go/auth/claims"
+	"github.com/worldline-go/auth/providers"
+)
+
+func TestNoopJWTKey_ParseWithClaims(t *testing.T) {
+	provider := Provider{
+		Active: ProviderNoopKey,
+		Noop: &providers.Noop{
+			Subject:  "1234",
+			Username: "dev",
+			Roles:    []string{"admin"},
+			Scopes:   []string{"read", "write"},
+			Custom: map[string]interface{}{
+				"email": "dev@example.com",
+			},
+		},
+	}
+
+	jwks, err := provider.ActiveProvider().JWTKeyFunc()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	customClaims := &claims.Custom{}
+	token, err := jwks.ParseWithClaims(NoopKey, customClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !token.Valid {
+		t.Errorf("token is not valid")
+	}
+
+	if customClaims.Subject != "1234" || customClaims.User != "dev" {
+		t.Errorf("unexpected identity: %q %q", customClaims.Subject, customClaims.User)
+	}
+
+	if !customClaims.HasRole("admin") || !customClaims.HasScope("write") {
+		t.Errorf("roles or scopes not set: %v %v", customClaims.RoleSet, customClaims.ScopeSet)
+	}
+
+	if customClaims.Map["email"] != "dev@example.com" {
+		t.Errorf("custom claim not set: %v", customClaims.Map)
+	}
+}
+
+func TestProvider_ActiveProviderNoopGuard(t *testing.T) {
+	provider := Provider{
+		Active: ProviderNoopKey,
+	}
+
+	t.Setenv(NoopDevModeEnv, "")
+	if v := provider.ActiveProvider(WithNoopGuard(true)); v != nil {
+		t.Errorf("noop provider activated without %s", NoopDevModeEnv)
+	}
+
+	t.Setenv(NoopDevModeEnv, "true")
+	if v := provider.ActiveProvider(WithNoopGuard(true)); v == nil || !v.IsNoop() {
+		t.Errorf("noop provider not activated with %s", NoopDevModeEnv)
+	}
+}
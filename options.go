@@ -1,8 +1,9 @@
 package auth
 
 type optionsActiveProvider struct {
-	noop   bool
-	active string
+	noop      bool
+	noopGuard bool
+	active    string
 }
 
 type OptionActiveProvider func(options *optionsActiveProvider)
@@ -14,6 +15,13 @@ func WithNoop(v bool) OptionActiveProvider {
 	}
 }
 
+// WithNoopGuard refuses to activate the noop provider unless NoopDevModeEnv environment variable is true.
+func WithNoopGuard(v bool) OptionActiveProvider {
+	return func(options *optionsActiveProvider) {
+		options.noopGuard = v
+	}
+}
+
 func WithActive(provider string) OptionActiveProvider {
 	return func(options *optionsActiveProvider) {
 		options.active = provider
@@ -0,0 +1,87 @@
+package authecho
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// cacheMaxSize is the maximum count of the values in the cache, a value is evicted to add a new one at the limit.
+var cacheMaxSize = 10000
+
+// cacheSweepInterval is the interval to remove the expired values in the cache.
+var cacheSweepInterval = time.Minute
+
+type cacheValue[T any] struct {
+	value  T
+	expire time.Time
+}
+
+// tokenCache holds values per token until the expire time.
+type tokenCache[T any] struct {
+	values map[string]cacheValue[T]
+	sweep  time.Time
+	m      sync.Mutex
+}
+
+func newTokenCache[T any]() *tokenCache[T] {
+	return &tokenCache[T]{
+		values: make(map[string]cacheValue[T]),
+	}
+}
+
+// cacheKey returns a hashed key to not hold the raw token in memory.
+func cacheKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (t *tokenCache[T]) Get(key string) (T, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	v, ok := t.values[key]
+	if !ok || time.Now().After(v.expire) {
+		var zero T
+
+		return zero, false
+	}
+
+	return v.value, true
+}
+
+func (t *tokenCache[T]) Set(key string, value T, expire time.Time) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	now := time.Now()
+	if now.After(t.sweep) {
+		for k, v := range t.values {
+			if now.After(v.expire) {
+				delete(t.values, k)
+			}
+		}
+
+		t.sweep = now.Add(cacheSweepInterval)
+	}
+
+	if _, ok := t.values[key]; !ok && len(t.values) >= cacheMaxSize {
+		// map order is not defined, any value is evicted
+		for k := range t.values {
+			delete(t.values, k)
+
+			break
+		}
+	}
+
+	t.values[key] = cacheValue[T]{
+		value:  value,
+		expire: expire,
+	}
+}
@@ -0,0 +1,44 @@
+package authecho
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTokenCache(t *testing.T) {
+	defer func(size int, interval time.Duration) {
+		cacheMaxSize, cacheSweepInterval = size, interval
+	}(cacheMaxSize, cacheSweepInterval)
+
+	cacheMaxSize = 3
+	cacheSweepInterval = time.Hour
+
+	cache := newTokenCache[int]()
+
+	cache.Set("expired", 0, time.Now().Add(-time.Second))
+	for i := 1; i <= 5; i++ {
+		cache.Set(strconv.Itoa(i), i, time.Now().Add(time.Hour))
+	}
+
+	if got := len(cache.values); got != cacheMaxSize {
+		t.Errorf("cache size = %d, want %d", got, cacheMaxSize)
+	}
+
+	if v, ok := cache.Get("5"); !ok || v != 5 {
+		t.Errorf("Get() = %v, %v, want the last value", v, ok)
+	}
+
+	if _, ok := cache.Get("expired"); ok {
+		t.Errorf("Get() of expired value, want not found")
+	}
+
+	// sweep removes the expired values
+	cache.Set("expired", 0, time.Now().Add(-time.Second))
+	cache.sweep = time.Time{}
+	cache.Set("5", 5, time.Now().Add(time.Hour))
+
+	if _, ok := cache.values["expired"]; ok {
+		t.Errorf("expired value is not removed by the sweep")
+	}
+}
@@ -0,0 +1,202 @@
+package authecho
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/request"
+)
+
+// MiddlewareDPoP validates the DPoP proof of the requests with the DPoP authorization scheme, RFC 9449.
+//
+// Proof is checked with htm, htu, iat, jti replay and ath, and the token's cnf.jkt must match the proof key.
+// DPoP bound tokens are rejected with the Bearer scheme.
+//
+// This middleware should be used after the JWT middleware accepting the DPoP scheme, or use WithDPoP option of the JWT middleware.
+func MiddlewareDPoP(opts ...OptionDPoP) echo.MiddlewareFunc {
+	var options optionsDPoP
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.baseURL != "" {
+		base, err := url.Parse(options.baseURL)
+		if err != nil {
+			log.Error().Err(err).Msg("invalid dpop base url")
+		}
+
+		options.base = base
+	}
+
+	verifier := &auth.DPoPVerifier{
+		ProofAge: options.proofAge,
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if options.noop {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeyAuthNoop).(bool); ok && v {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeySkipper).(bool); ok && v {
+				return next(c)
+			}
+
+			accessToken := GetAccessToken(c)
+			if accessToken == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "token not found")
+			}
+
+			jkt, _ := auth.Confirmation(accessToken)["jkt"].(string)
+
+			if !isDPoPAuthorization(c.Request().Header.Get("Authorization")) {
+				// https://datatracker.ietf.org/doc/html/rfc9449#section-7.2
+				if jkt != "" {
+					return dpopError(c, "invalid_token", "DPoP bound token requires DPoP proof")
+				}
+
+				if options.required {
+					return dpopError(c, "invalid_token", "DPoP proof required")
+				}
+
+				return next(c)
+			}
+
+			proofs := c.Request().Header.Values(request.HeaderDPoP)
+			if len(proofs) != 1 {
+				return dpopError(c, request.ErrorCodeInvalidDPoPProof, "exactly one DPoP proof required")
+			}
+
+			// binding is checked before the jti is used, not bound proofs can't consume it
+			if err := verifier.VerifyBound(proofs[0], c.Request().Method, options.htu(c), accessToken, jkt); err != nil {
+				if errors.Is(err, auth.ErrDPoPNotBound) {
+					return dpopError(c, "invalid_token", "token is not bound to the DPoP proof key")
+				}
+
+				return dpopError(c, request.ErrorCodeInvalidDPoPProof, err.Error())
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// middlewareDPoPBound rejects the DPoP bound tokens without DPoP proof, used by the JWT middlewares without WithDPoP.
+//
+// https://datatracker.ietf.org/doc/html/rfc9449#section-7.1
+// Tokens of the redirection cookie are issued to this service and not checked.
+func middlewareDPoPBound(noop bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if noop {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeyAuthNoop).(bool); ok && v {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeyAccessToken).(string); ok && v != "" {
+				return next(c)
+			}
+
+			accessToken := GetAccessToken(c)
+			if accessToken == "" {
+				return next(c)
+			}
+
+			if jkt, _ := auth.Confirmation(accessToken)["jkt"].(string); jkt != "" {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, fmt.Sprintf("Bearer error=%q, error_description=%q", "invalid_token", "DPoP bound token requires DPoP proof"))
+
+				return echo.NewHTTPError(http.StatusUnauthorized, "DPoP bound token requires DPoP proof")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// isDPoPAuthorization reports the authorization header uses the DPoP scheme.
+func isDPoPAuthorization(authorization string) bool {
+	return strings.HasPrefix(strings.ToLower(authorization), strings.ToLower(request.TokenTypeDPoP)+" ")
+}
+
+// dpopError returns unauthorized error with the DPoP challenge.
+func dpopError(c echo.Context, code, description string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, fmt.Sprintf(
+		"%s error=%q, error_description=%q, algs=%q", request.TokenTypeDPoP, code, description, strings.Join(auth.DPoPAlgorithms, " "),
+	))
+
+	return echo.NewHTTPError(http.StatusUnauthorized, description)
+}
+
+type optionsDPoP struct {
+	required bool
+	proofAge time.Duration
+	baseURL  string
+	noop     bool
+
+	base *url.URL
+}
+
+// htu returns the request URL to compare with the proof.
+func (o *optionsDPoP) htu(c echo.Context) string {
+	u := url.URL{
+		Scheme: c.Scheme(),
+		Host:   c.Request().Host,
+		Path:   c.Request().URL.Path,
+	}
+
+	if o.base != nil {
+		u.Scheme = o.base.Scheme
+		u.Host = o.base.Host
+		u.Path = strings.TrimSuffix(o.base.Path, "/") + u.Path
+	}
+
+	return request.DPoPHTU(&u)
+}
+
+type OptionDPoP func(*optionsDPoP)
+
+// WithDPoPRequired rejects the requests without DPoP proof.
+func WithDPoPRequired(v bool) OptionDPoP {
+	return func(opts *optionsDPoP) {
+		opts.required = v
+	}
+}
+
+// WithDPoPProofAge sets the accepted difference of the proof's iat, default is auth.DefaultDPoPProofAge.
+func WithDPoPProofAge(d time.Duration) OptionDPoP {
+	return func(opts *optionsDPoP) {
+		opts.proofAge = d
+	}
+}
+
+// WithDPoPBaseURL sets the external URL of the service to check htu behind a proxy, like "https://api.example.com".
+//
+// Default is the scheme and host of the request.
+func WithDPoPBaseURL(baseURL string) OptionDPoP {
+	return func(opts *optionsDPoP) {
+		opts.baseURL = baseURL
+	}
+}
+
+// WithNoopDPoP sets the noop option.
+//
+// If provider already has a noop, this one will be ignored.
+func WithNoopDPoP(v bool) OptionDPoP {
+	return func(opts *optionsDPoP) {
+		opts.noop = v
+	}
+}
@@ -0,0 +1,222 @@
+package authecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/worldline-go/auth/request"
+)
+
+func TestMiddlewareDPoP(t *testing.T) {
+	secret := []byte("test-secret")
+
+	dpop, err := request.NewDPoP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherDPoP, err := request.NewDPoP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken := func(t *testing.T, jkt string) string {
+		t.Helper()
+
+		claims := jwt.MapClaims{"sub": "test"}
+		if jkt != "" {
+			claims["cnf"] = map[string]interface{}{"jkt": jkt}
+		}
+
+		v, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	proof := func(t *testing.T, d *request.DPoP, method, rawURL, token string) string {
+		t.Helper()
+
+		v, err := d.Proof(method, rawURL, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	boundToken := newToken(t, dpop.Thumbprint())
+	replayProof := proof(t, dpop, http.MethodGet, "http://example.com/test", boundToken)
+
+	tests := []struct {
+		name   string
+		scheme string
+		token  string
+		proof  string
+		want   int
+	}{
+		{
+			name:   "valid",
+			scheme: "DPoP",
+			token:  boundToken,
+			proof:  replayProof,
+			want:   http.StatusOK,
+		},
+		{
+			name:   "replay",
+			scheme: "DPoP",
+			token:  boundToken,
+			proof:  replayProof,
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "bound token as bearer",
+			scheme: "Bearer",
+			token:  boundToken,
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "unbound bearer",
+			scheme: "Bearer",
+			token:  newToken(t, ""),
+			want:   http.StatusOK,
+		},
+		{
+			name:   "missing proof",
+			scheme: "DPoP",
+			token:  boundToken,
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "other key",
+			scheme: "DPoP",
+			token:  boundToken,
+			proof:  proof(t, otherDPoP, http.MethodGet, "http://example.com/test", boundToken),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "htu mismatch",
+			scheme: "DPoP",
+			token:  boundToken,
+			proof:  proof(t, dpop, http.MethodGet, "http://example.com/other", boundToken),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "htm mismatch",
+			scheme: "DPoP",
+			token:  boundToken,
+			proof:  proof(t, dpop, http.MethodPost, "http://example.com/test", boundToken),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "ath mismatch",
+			scheme: "DPoP",
+			token:  boundToken,
+			proof:  proof(t, dpop, http.MethodGet, "http://example.com/test", "other-token"),
+			want:   http.StatusUnauthorized,
+		},
+	}
+
+	e := echo.New()
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, MiddlewareJWT(
+		WithKeyFunc(func(_ *jwt.Token) (interface{}, error) { return secret, nil }),
+		WithDPoP(),
+	))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/test?x=1", nil)
+			req.Header.Set("Authorization", tt.scheme+" "+tt.token)
+			if tt.proof != "" {
+				req.Header.Set(request.HeaderDPoP, tt.proof)
+			}
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("MiddlewareDPoP() = %v, want %v, body %s", rec.Code, tt.want, rec.Body.String())
+			}
+
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get(echo.HeaderWWWAuthenticate) == "" {
+				t.Errorf("MiddlewareDPoP() WWW-Authenticate header not set")
+			}
+		})
+	}
+}
+
+func TestMiddlewareJWT_DPoPBound(t *testing.T) {
+	secret := []byte("test-secret")
+
+	dpop, err := request.NewDPoP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken := func(t *testing.T, jkt string) string {
+		t.Helper()
+
+		claims := jwt.MapClaims{"sub": "test"}
+		if jkt != "" {
+			claims["cnf"] = map[string]interface{}{"jkt": jkt}
+		}
+
+		v, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{
+			name:  "bound token as bearer",
+			token: newToken(t, dpop.Thumbprint()),
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:  "unbound bearer",
+			token: newToken(t, ""),
+			want:  http.StatusOK,
+		},
+	}
+
+	// without WithDPoP option
+	e := echo.New()
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, MiddlewareJWT(
+		WithKeyFunc(func(_ *jwt.Token) (interface{}, error) { return secret, nil }),
+	))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("MiddlewareJWT() = %v, want %v, body %s", rec.Code, tt.want, rec.Body.String())
+			}
+
+			if rec.Code == http.StatusUnauthorized && !strings.Contains(rec.Header().Get(echo.HeaderWWWAuthenticate), "invalid_token") {
+				t.Errorf("MiddlewareJWT() WWW-Authenticate = %q, want invalid_token", rec.Header().Get(echo.HeaderWWWAuthenticate))
+			}
+		})
+	}
+}
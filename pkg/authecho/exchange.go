@@ -0,0 +1,159 @@
+package authecho
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/request"
+	"github.com/worldline-go/auth/store"
+)
+
+// GetAccessToken returns the access token of the request from the echo context.
+//
+// Returns empty string if JWT middleware not set the token.
+func GetAccessToken(c echo.Context) string {
+	if token, ok := c.Get(KeyToken).(*jwt.Token); ok && token.Raw != "" {
+		return token.Raw
+	}
+
+	if v, ok := c.Get(KeyAccessToken).(string); ok {
+		return v
+	}
+
+	return ""
+}
+
+// TokenExchange exchanges the access token of the request with the token exchange flow.
+//
+// SubjectToken in the config is set with the access token of the request.
+func TokenExchange(c echo.Context, authClient *request.Auth, cfg request.TokenExchangeConfig) (*store.Token, error) {
+	cfg.SubjectToken = GetAccessToken(c)
+	if cfg.SubjectToken == "" {
+		return nil, fmt.Errorf("access token not found")
+	}
+
+	if authClient == nil {
+		authClient = request.DefaultAuth
+	}
+
+	body, err := authClient.TokenExchange(c.Request().Context(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+
+	return store.Parse(string(body))
+}
+
+// TokenExchangeRoundTripper returns a RoundTripper with the exchanged token of the request.
+//
+// Use it for calling downstream services on behalf of the user, audience of the token set in the config.
+// It is auth.NewForwardRoundTripper with auth.WithForwardExchange bound to the access token of the request,
+// token is exchanged in the first call.
+// Forward RoundTripper is shared for the same authClient and config, exchanged tokens are cached between requests.
+//
+//	transport, err := authecho.TokenExchangeRoundTripper(c, http.DefaultTransport, nil, request.TokenExchangeConfig{
+//		Audience: []string{"downstream-service"},
+//		AuthRequestConfig: request.AuthRequestConfig{
+//			TokenURL:     provider.GetTokenURL(),
+//			ClientID:     provider.GetClientID(),
+//			ClientSecret: provider.GetClientSecret(),
+//		},
+//	})
+func TokenExchangeRoundTripper(c echo.Context, transport http.RoundTripper, authClient *request.Auth, cfg request.TokenExchangeConfig) (http.RoundTripper, error) {
+	accessToken := GetAccessToken(c)
+	if accessToken == "" {
+		return nil, fmt.Errorf("access token not found")
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &accessTokenTransport{
+		accessToken: accessToken,
+		transport:   transport,
+		base:        exchangeTransports.get(authClient, cfg),
+	}, nil
+}
+
+// exchangeTransportMax is the maximum count of the shared forward RoundTrippers of TokenExchangeRoundTripper.
+var exchangeTransportMax = 100
+
+// exchangeTransports holds the forward RoundTrippers per authClient and config.
+var exchangeTransports = &exchangeTransportCache{
+	transports: make(map[exchangeTransportKey]http.RoundTripper),
+}
+
+type exchangeTransportKey struct {
+	authClient *request.Auth
+	cfg        string
+}
+
+type exchangeTransportCache struct {
+	mutex      sync.Mutex
+	transports map[exchangeTransportKey]http.RoundTripper
+}
+
+// get returns the forward RoundTripper of the config, base transport is read from the request context.
+func (c *exchangeTransportCache) get(authClient *request.Auth, cfg request.TokenExchangeConfig) http.RoundTripper {
+	// subject token is set by the forward RoundTripper
+	cfg.SubjectToken = ""
+	key := exchangeTransportKey{
+		authClient: authClient,
+		cfg:        fmt.Sprintf("%#v", cfg),
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if v, ok := c.transports[key]; ok {
+		return v
+	}
+
+	// configs are mostly static, drop any of them at the limit
+	if len(c.transports) >= exchangeTransportMax {
+		for k := range c.transports {
+			delete(c.transports, k)
+
+			break
+		}
+	}
+
+	v := auth.NewForwardRoundTripper(contextTransport{}, auth.WithForwardExchange(auth.NewTokenExchangeFunc(authClient, cfg)))
+	c.transports[key] = v
+
+	return v
+}
+
+type ctxTransport struct{}
+
+// contextTransport sends the request with the transport of the request context.
+type contextTransport struct{}
+
+func (contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, _ := req.Context().Value(ctxTransport{}).(http.RoundTripper)
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return transport.RoundTrip(req)
+}
+
+// accessTokenTransport sets the access token and the transport to the request context for the forward RoundTripper.
+type accessTokenTransport struct {
+	accessToken string
+	transport   http.RoundTripper
+	base        http.RoundTripper
+}
+
+func (t *accessTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := auth.WithAccessToken(req.Context(), t.accessToken)
+	ctx = context.WithValue(ctx, ctxTransport{}, t.transport)
+
+	return t.base.RoundTrip(req.WithContext(ctx))
+}
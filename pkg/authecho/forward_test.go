@@ -0,0 +1,96 @@
+package authecho
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/request"
+)
+
+func TestMiddlewareJWT_forwardAccessToken(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "test"}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	fn := MiddlewareJWT(WithKeyFunc(func(*jwt.Token) (interface{}, error) {
+		return []byte("test"), nil
+	}))(func(c echo.Context) error {
+		got = auth.AccessTokenFromContext(c.Request().Context())
+
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	e := echo.New()
+	if err := fn(e.NewContext(req, httptest.NewRecorder())); err != nil {
+		t.Fatalf("MiddlewareJWT() error = %v", err)
+	}
+
+	if got != token {
+		t.Errorf("AccessTokenFromContext() = %q, want %q", got, token)
+	}
+}
+
+func TestTokenExchangeRoundTripper_shared(t *testing.T) {
+	var exchanges int32
+	serverToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&exchanges, 1)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"exchanged","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer serverToken.Close()
+
+	serverAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer serverAPI.Close()
+
+	cfg := request.TokenExchangeConfig{
+		Audience: []string{"downstream-service"},
+		AuthRequestConfig: request.AuthRequestConfig{
+			TokenURL:     serverToken.URL,
+			ClientID:     "test",
+			ClientSecret: "secret",
+		},
+	}
+
+	e := echo.New()
+
+	// each request builds its own RoundTripper
+	for i := 0; i < 3; i++ {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		c.Set(KeyAccessToken, "user-token")
+
+		transport, err := TokenExchangeRoundTripper(c, http.DefaultTransport, nil, cfg)
+		if err != nil {
+			t.Fatalf("TokenExchangeRoundTripper() error = %v", err)
+		}
+
+		resp, err := (&http.Client{Transport: transport}).Get(serverAPI.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != "Bearer exchanged" {
+			t.Errorf("Authorization = %q, want %q", body, "Bearer exchanged")
+		}
+	}
+
+	if got := atomic.LoadInt32(&exchanges); got != 1 {
+		t.Errorf("exchanges = %d, want 1", got)
+	}
+}
@@ -95,6 +95,7 @@ func getOptions(opts ...Option) options {
 
 	// is it noop?
 	noop := options.noop
+	noopParser := false
 	introspect := false
 
 	if options.config.KeyFunc != nil {
@@ -103,6 +104,7 @@ func getOptions(opts ...Option) options {
 		case auth.NoopKey:
 			options.noop = true
 			noop = true
+			noopParser = options.parser != nil
 		case auth.IntrospectKey:
 			introspect = true
 		}
@@ -119,6 +121,9 @@ func getOptions(opts ...Option) options {
 	}
 
 	options.config.TokenLookup = "header:Authorization:Bearer "
+	if options.dpop != nil {
+		options.config.TokenLookup += ",header:Authorization:" + request.TokenTypeDPoP + " "
+	}
 	if noop {
 		// set the custom token lookup function after the default functions
 		extractors, err := echojwt.CreateExtractors(options.config.TokenLookup)
@@ -140,11 +145,18 @@ func getOptions(opts ...Option) options {
 
 		jwtParser := jwt.NewParser()
 		options.config.ParseTokenFunc = func(c echo.Context, tokenStr string) (interface{}, error) {
-			token, _, err := jwtParser.ParseUnverified(tokenStr, options.config.NewClaimsFunc(c))
+			claims := options.config.NewClaimsFunc(c)
+
+			// noop parser of the provider sets the identity
+			if noopParser {
+				return options.parser(tokenStr, claims)
+			}
+
+			token, _, err := jwtParser.ParseUnverified(tokenStr, claims)
 			if err != nil {
 				// ignore error if noop
 				if v, ok := c.Get(KeyAuthNoop).(bool); ok && v {
-					return auth.NoopKey, nil
+					return auth.NoopToken(nil, options.config.NewClaimsFunc(c))
 				}
 
 				return nil, fmt.Errorf("failed to parse the JWT: %w", err)
@@ -178,7 +190,17 @@ func getOptions(opts ...Option) options {
 func MiddlewareJWT(opts ...Option) echo.MiddlewareFunc {
 	options := getOptions(opts...)
 
-	return echojwt.WithConfig(options.config)
+	middlewareJWT := echojwt.WithConfig(options.config)
+
+	after := options.afterJWT()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		for i := len(after) - 1; i >= 0; i-- {
+			next = after[i](next)
+		}
+
+		return middlewareJWT(next)
+	}
 }
 
 // MiddlewareJWTWithRedirection returns a JWT middleware with usable redirection option.
@@ -261,6 +283,12 @@ func MiddlewareJWTWithRedirection(opts ...Option) []echo.MiddlewareFunc {
 						}
 
 						query.Set("id_token_hint", cookieParsed.IDToken)
+
+						if options.redirect.Logout.Revoke && cookieParsed.RefreshToken != "" {
+							if err := redirect.RevokeToken(c.Request().Context(), cookieParsed.RefreshToken, options.redirect); err != nil {
+								c.Logger().Errorf("failed RevokeToken: %v", err)
+							}
+						}
 					}
 
 					// query.Set("client_id", options.redirect.ClientID)
@@ -361,7 +389,7 @@ func MiddlewareJWTWithRedirection(opts ...Option) []echo.MiddlewareFunc {
 
 				// remove code from query params to prevent goes to authentication call
 				redirect.RemoveAuthQueryParams(c.Request())
-				if err := redirect.CodeToken(c.Request().Context(), c.Request(), c.Response(), code, cookieName, options.redirect, sessionStore); err != nil {
+				if err := redirect.CodeToken(c.Request().Context(), c.Request(), c.Response(), code, cookieName, options.redirect, sessionStore, redirect.WithCodeVerifier(rValue.CodeVerifier)); err != nil {
 					c.Set(KeyAuthError, err.Error())
 					c.Logger().Errorf("failed CodeToken: %v", err)
 
@@ -460,6 +488,24 @@ func MiddlewareJWTWithRedirection(opts ...Option) []echo.MiddlewareFunc {
 			if options.redirect.Scopes != nil {
 				data.Add("scope", strings.Join(options.redirect.Scopes, " "))
 			}
+			// https://datatracker.ietf.org/doc/html/rfc7636#section-4.3
+			if codeChallenge := redirectValue.CodeChallenge(); codeChallenge != "" {
+				data.Add("code_challenge", codeChallenge)
+				data.Add("code_challenge_method", "S256")
+			}
+
+			// https://datatracker.ietf.org/doc/html/rfc9126#section-4
+			if options.redirect.UsePAR {
+				authURL, err := redirect.PushAuthorization(c.Request().Context(), data, options.redirect)
+				if err != nil {
+					c.Set(KeyAuthError, err.Error())
+					c.Logger().Errorf("failed PushAuthorization: %v", err)
+
+					return echo.NewHTTPError(http.StatusFailedDependency, "failed pushed authorization request").SetInternal(err)
+				}
+
+				return c.Redirect(http.StatusTemporaryRedirect, authURL)
+			}
 
 			redirect := options.redirect.AuthURL + "?" + data.Encode()
 
@@ -467,7 +513,56 @@ func MiddlewareJWTWithRedirection(opts ...Option) []echo.MiddlewareFunc {
 		}
 	}
 
-	return append(functions, echojwt.WithConfig(options.config))
+	functions = append(functions, echojwt.WithConfig(options.config))
+
+	return append(functions, options.afterJWT()...)
+}
+
+// afterJWT returns the middlewares of the options to run after the token validation.
+func (o *options) afterJWT() []echo.MiddlewareFunc {
+	functions := []echo.MiddlewareFunc{middlewareForward(o.noop)}
+
+	if o.dpop != nil {
+		functions = append(functions, MiddlewareDPoP(append(o.dpop, WithNoopDPoP(o.noop))...))
+	} else {
+		functions = append(functions, middlewareDPoPBound(o.noop))
+	}
+
+	if o.mtls != nil {
+		functions = append(functions, MiddlewareMTLS(append(o.mtls, WithNoopMTLS(o.noop))...))
+	}
+
+	if o.userInfo != nil {
+		functions = append(functions, MiddlewareUserInfo(append(o.userInfo, WithNoopUserInfo(o.noop))...))
+	}
+
+	return functions
+}
+
+// middlewareForward sets the access token to the request context for auth.NewForwardRoundTripper.
+func middlewareForward(noop bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if noop {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeyAuthNoop).(bool); ok && v {
+				return next(c)
+			}
+
+			if accessToken := GetAccessToken(c); accessToken != "" {
+				ctx := auth.WithAccessToken(c.Request().Context(), accessToken)
+				if isDPoPAuthorization(c.Request().Header.Get(echo.HeaderAuthorization)) {
+					ctx = auth.WithAccessTokenType(ctx, request.TokenTypeDPoP)
+				}
+
+				c.SetRequest(c.Request().WithContext(ctx))
+			}
+
+			return next(c)
+		}
+	}
 }
 
 func clearCookies(r *http.Request, w http.ResponseWriter, redirectSetting *redirect.Setting, cookieName string, sessionStore store.SessionStore) {
@@ -0,0 +1,118 @@
+package authecho
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/worldline-go/auth"
+)
+
+// MiddlewareMTLS checks the certificate bound access tokens with the client certificate, RFC 8705.
+//
+// Thumbprint of the TLS peer certificate or the forwarded certificate header is compared with the token's cnf.x5t#S256.
+// Tokens without the binding are passed unless required.
+//
+// This middleware should be used after the JWT middleware, or use WithMTLS option of the JWT middleware.
+func MiddlewareMTLS(opts ...OptionMTLS) echo.MiddlewareFunc {
+	var options optionsMTLS
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if options.noop {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeyAuthNoop).(bool); ok && v {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeySkipper).(bool); ok && v {
+				return next(c)
+			}
+
+			accessToken := GetAccessToken(c)
+			if accessToken == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "token not found")
+			}
+
+			cert, err := options.certificate(c.Request())
+			if err != nil {
+				return mtlsError(c, err)
+			}
+
+			if err := auth.VerifyCertificateBinding(accessToken, cert); err != nil {
+				if errors.Is(err, auth.ErrTokenNotCertificateBound) && !options.required {
+					return next(c)
+				}
+
+				return mtlsError(c, err)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// mtlsError returns unauthorized error with the invalid_token challenge, internal error is the auth error.
+func mtlsError(c echo.Context, err error) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, fmt.Sprintf("Bearer error=%q, error_description=%q", "invalid_token", err.Error()))
+
+	return echo.NewHTTPError(http.StatusUnauthorized, err.Error()).SetInternal(err)
+}
+
+type optionsMTLS struct {
+	header   string
+	required bool
+	noop     bool
+}
+
+// certificate returns the peer certificate or the forwarded certificate, nil if not exists.
+func (o *optionsMTLS) certificate(r *http.Request) (*x509.Certificate, error) {
+	if o.header != "" {
+		v := r.Header.Get(o.header)
+		if v == "" {
+			return nil, nil
+		}
+
+		return auth.ParseForwardedCertificate(v)
+	}
+
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+
+	return r.TLS.PeerCertificates[0], nil
+}
+
+type OptionMTLS func(*optionsMTLS)
+
+// WithMTLSHeader sets the header of the client certificate forwarded by the ingress, like "X-Forwarded-Client-Cert".
+//
+// TLS peer certificate is not used with this option, the header must be set only by the trusted proxy.
+func WithMTLSHeader(header string) OptionMTLS {
+	return func(opts *optionsMTLS) {
+		opts.header = header
+	}
+}
+
+// WithMTLSRequired rejects the tokens without certificate binding.
+func WithMTLSRequired(v bool) OptionMTLS {
+	return func(opts *optionsMTLS) {
+		opts.required = v
+	}
+}
+
+// WithNoopMTLS sets the noop option.
+//
+// If provider already has a noop, this one will be ignored.
+func WithNoopMTLS(v bool) OptionMTLS {
+	return func(opts *optionsMTLS) {
+		opts.noop = v
+	}
+}
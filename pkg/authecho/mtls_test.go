@@ -0,0 +1,169 @@
+package authecho
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/worldline-go/auth"
+)
+
+func newTestCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestMiddlewareMTLS(t *testing.T) {
+	cert := newTestCertificate(t)
+	otherCert := newTestCertificate(t)
+
+	newToken := func(t *testing.T, x5t string) string {
+		t.Helper()
+
+		claims := jwt.MapClaims{"sub": "test"}
+		if x5t != "" {
+			claims["cnf"] = map[string]interface{}{auth.ConfirmationX5TS256: x5t}
+		}
+
+		v, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	boundToken := newToken(t, auth.CertificateThumbprint(cert))
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+
+	tests := []struct {
+		name    string
+		opts    []OptionMTLS
+		token   string
+		peer    *x509.Certificate
+		header  string
+		wantErr error
+	}{
+		{
+			name:  "peer certificate",
+			token: boundToken,
+			peer:  cert,
+		},
+		{
+			name:    "peer certificate mismatch",
+			token:   boundToken,
+			peer:    otherCert,
+			wantErr: auth.ErrCertificateMismatch,
+		},
+		{
+			name:    "no certificate",
+			token:   boundToken,
+			wantErr: auth.ErrCertificateNotFound,
+		},
+		{
+			name:  "not bound",
+			token: newToken(t, ""),
+			peer:  cert,
+		},
+		{
+			name:    "not bound required",
+			opts:    []OptionMTLS{WithMTLSRequired(true)},
+			token:   newToken(t, ""),
+			peer:    cert,
+			wantErr: auth.ErrTokenNotCertificateBound,
+		},
+		{
+			name:   "forwarded escaped PEM",
+			opts:   []OptionMTLS{WithMTLSHeader("X-Client-Cert")},
+			token:  boundToken,
+			header: url.PathEscape(string(certPEM)),
+		},
+		{
+			name:   "forwarded base64 DER",
+			opts:   []OptionMTLS{WithMTLSHeader("X-Client-Cert")},
+			token:  boundToken,
+			header: base64.StdEncoding.EncodeToString(cert.Raw),
+		},
+		{
+			name:    "forwarded header ignores peer",
+			opts:    []OptionMTLS{WithMTLSHeader("X-Client-Cert")},
+			token:   boundToken,
+			peer:    cert,
+			header:  base64.StdEncoding.EncodeToString(otherCert.Raw),
+			wantErr: auth.ErrCertificateMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := HandlerFunc{}
+			fn := MiddlewareMTLS(tt.opts...)(handler.Fn)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.peer != nil {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.peer}}
+			}
+
+			if tt.header != "" {
+				req.Header.Set("X-Client-Cert", tt.header)
+			}
+
+			e := echo.New()
+			echoCtx := e.NewContext(req, httptest.NewRecorder())
+			echoCtx.Set(KeyToken, &jwt.Token{Raw: tt.token})
+
+			err := fn(echoCtx)
+			if tt.wantErr == nil {
+				if err != nil || handler.Count != 1 {
+					t.Errorf("MiddlewareMTLS() error = %v, count = %v", err, handler.Count)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("MiddlewareMTLS() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if handler.Count != 0 {
+				t.Errorf("MiddlewareMTLS() handler called")
+			}
+		})
+	}
+}
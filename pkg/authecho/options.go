@@ -4,6 +4,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/worldline-go/auth/models"
 	"github.com/worldline-go/auth/redirect"
 )
 
@@ -14,6 +15,10 @@ type options struct {
 
 	noop   bool
 	parser func(tokenString string, claims jwt.Claims) (*jwt.Token, error)
+
+	userInfo []OptionUserInfo
+	dpop     []OptionDPoP
+	mtls     []OptionMTLS
 }
 
 type Option func(*options)
@@ -47,6 +52,16 @@ func WithKeyFunc(fn jwt.Keyfunc) Option {
 	}
 }
 
+// WithKeyFuncParser sets the key and parser functions of the JWKS.
+//
+// Noop provider's parser sets the configured identity as claims when no token is sent.
+func WithKeyFuncParser(jwks models.InfKeyFuncParser) Option {
+	return func(opts *options) {
+		opts.config.KeyFunc = jwks.Keyfunc
+		opts.parser = jwks.ParseWithClaims
+	}
+}
+
 func WithParserFunc(fn func(tokenString string, claims jwt.Claims) (*jwt.Token, error)) Option {
 	return func(opts *options) {
 		opts.parser = fn
@@ -64,3 +79,26 @@ func WithRedirect(redirectSetting *redirect.Setting) Option {
 		opts.redirect = redirectSetting
 	}
 }
+
+// WithUserInfo calls the userinfo endpoint after the token is validated and merges the result to the claims.
+//
+// Only usable with the default *claims.Custom claims, see MiddlewareUserInfo.
+func WithUserInfo(opts ...OptionUserInfo) Option {
+	return func(options *options) {
+		options.userInfo = append([]OptionUserInfo{}, opts...)
+	}
+}
+
+// WithDPoP accepts the DPoP authorization scheme and validates the DPoP proofs, see MiddlewareDPoP.
+func WithDPoP(opts ...OptionDPoP) Option {
+	return func(options *options) {
+		options.dpop = append([]OptionDPoP{}, opts...)
+	}
+}
+
+// WithMTLS checks the certificate bound tokens with the client certificate, see MiddlewareMTLS.
+func WithMTLS(opts ...OptionMTLS) Option {
+	return func(options *options) {
+		options.mtls = append([]OptionMTLS{}, opts...)
+	}
+}
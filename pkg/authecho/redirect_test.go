@@ -0,0 +1,314 @@
+package authecho
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/authtest"
+	"github.com/worldline-go/auth/redirect"
+	"github.com/worldline-go/auth/request"
+	"github.com/worldline-go/auth/store"
+)
+
+const redirectTestBaseURL = "http://app.example.com"
+
+// newRedirectEcho returns an echo server with the redirection middlewares of the provider.
+func newRedirectEcho(t *testing.T, provider auth.InfProviderExtra, modify func(setting *redirect.Setting)) *echo.Echo {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	jwks, err := provider.JWTKeyFunc(auth.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setting := &redirect.Setting{
+		Scopes:  []string{"openid"},
+		BaseURL: redirectTestBaseURL,
+		Logout: redirect.Logout{
+			Path:     "/logout",
+			Redirect: redirectTestBaseURL,
+		},
+	}
+
+	provider.SetRedirect(setting)
+
+	if modify != nil {
+		modify(setting)
+	}
+
+	e := echo.New()
+	e.GET("/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}, MiddlewareJWTWithRedirection(WithKeyFuncParser(jwks), WithRedirect(setting))...)
+
+	return e
+}
+
+// redirectProvider returns the provider of the authtest server.
+func redirectProvider(srv *authtest.Server) auth.InfProviderExtra {
+	return (&auth.Provider{Generic: srv.Generic()}).ActiveProvider()
+}
+
+// serve calls the echo server with the cookies and returns the response.
+func serve(e *echo.Echo, target string, cookies ...*http.Cookie) *http.Response {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec.Result()
+}
+
+// followProvider calls the provider's authorization URL and returns the redirect location with the code.
+func followProvider(t *testing.T, authURL string) string {
+	t.Helper()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	return resp.Header.Get("Location")
+}
+
+func responseCookie(resp *http.Response, name string) *http.Cookie {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == name && cookie.Value != "" {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+func decodeCookie(t *testing.T, cookie *http.Cookie, v interface{}) {
+	t.Helper()
+
+	body, err := base64.StdEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// login runs the authorization code flow and returns the token cookie.
+func login(t *testing.T, e *echo.Echo) *http.Cookie {
+	t.Helper()
+
+	resp := serve(e, redirectTestBaseURL+"/page")
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("status = %d, want redirect to login", resp.StatusCode)
+	}
+
+	redirectCookie := responseCookie(resp, "auth_test_redirect")
+	if redirectCookie == nil {
+		t.Fatal("redirect cookie not set")
+	}
+
+	callback := followProvider(t, resp.Header.Get("Location"))
+
+	resp = serve(e, callback, redirectCookie)
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("callback status = %d, want %d", resp.StatusCode, http.StatusTemporaryRedirect)
+	}
+
+	tokenCookie := responseCookie(resp, "auth_test")
+	if tokenCookie == nil {
+		t.Fatal("token cookie not set after the code exchange")
+	}
+
+	return tokenCookie
+}
+
+func TestMiddlewareJWTWithRedirection_PKCE(t *testing.T) {
+	srv := authtest.NewServer(authtest.WithUser(authtest.User{Username: "user", Password: "pass"}))
+	defer srv.Close()
+
+	e := newRedirectEcho(t, redirectProvider(srv), nil)
+
+	resp := serve(e, redirectTestBaseURL+"/page")
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusTemporaryRedirect)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redirectCookie := responseCookie(resp, "auth_test_redirect")
+	if redirectCookie == nil {
+		t.Fatal("redirect cookie not set")
+	}
+
+	var rValue redirect.RedirectValue
+	decodeCookie(t, redirectCookie, &rValue)
+
+	if rValue.CodeVerifier == "" {
+		t.Fatal("code verifier not stored")
+	}
+
+	query := location.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") != store.CodeChallengeS256(rValue.CodeVerifier) {
+		t.Errorf("code challenge = %q %q, want S256 of the stored verifier", query.Get("code_challenge"), query.Get("code_challenge_method"))
+	}
+
+	if query.Get("state") != rValue.State {
+		t.Errorf("state = %q, want %q", query.Get("state"), rValue.State)
+	}
+
+	// provider checks the verifier in the code exchange
+	tokenCookie := login(t, e)
+
+	if resp := serve(e, redirectTestBaseURL+"/page", tokenCookie); resp.StatusCode != http.StatusOK {
+		t.Errorf("status with token cookie = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestMiddlewareJWTWithRedirection_LogoutRevoke(t *testing.T) {
+	srv := authtest.NewServer(authtest.WithUser(authtest.User{Username: "user", Password: "pass"}))
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		revoke      bool
+		wantRevoked bool
+	}{
+		{
+			name:        "revoke",
+			revoke:      true,
+			wantRevoked: true,
+		},
+		{
+			name:        "without revoke",
+			revoke:      false,
+			wantRevoked: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newRedirectEcho(t, redirectProvider(srv), func(setting *redirect.Setting) {
+				setting.Logout.Revoke = tt.revoke
+			})
+
+			tokenCookie := login(t, e)
+
+			var token request.TokenResponse
+			decodeCookie(t, tokenCookie, &token)
+
+			if token.RefreshToken == "" || !srv.IsRefreshTokenActive(token.RefreshToken) {
+				t.Fatal("refresh token not active after login")
+			}
+
+			resp := serve(e, redirectTestBaseURL+"/logout", tokenCookie)
+			if resp.StatusCode != http.StatusTemporaryRedirect || !strings.HasPrefix(resp.Header.Get("Location"), srv.Generic().LogoutURL) {
+				t.Fatalf("logout = %d %q, want redirect to logout URL", resp.StatusCode, resp.Header.Get("Location"))
+			}
+
+			if revoked := !srv.IsRefreshTokenActive(token.RefreshToken); revoked != tt.wantRevoked {
+				t.Errorf("refresh token revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestMiddlewareJWTWithRedirection_PAR(t *testing.T) {
+	srv := authtest.NewServer(authtest.WithUser(authtest.User{Username: "user", Password: "pass"}))
+	defer srv.Close()
+
+	t.Run("pushed", func(t *testing.T) {
+		e := newRedirectEcho(t, redirectProvider(srv), func(setting *redirect.Setting) {
+			setting.UsePAR = true
+		})
+
+		resp := serve(e, redirectTestBaseURL+"/page")
+		if resp.StatusCode != http.StatusTemporaryRedirect {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusTemporaryRedirect)
+		}
+
+		location, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		query := location.Query()
+		if location.Scheme+"://"+location.Host+location.Path != srv.Generic().AuthURL ||
+			len(query) != 2 || query.Get("client_id") != "test" ||
+			!strings.HasPrefix(query.Get("request_uri"), "urn:ietf:params:oauth:request_uri:") {
+			t.Fatalf("location = %q, want auth URL with only client_id and request_uri", location)
+		}
+
+		// pushed parameters complete the login
+		login(t, e)
+	})
+
+	t.Run("failed push", func(t *testing.T) {
+		e := newRedirectEcho(t, redirectProvider(srv), func(setting *redirect.Setting) {
+			setting.UsePAR = true
+			setting.ClientSecret = "wrong"
+		})
+
+		resp := serve(e, redirectTestBaseURL+"/page")
+		if resp.StatusCode != http.StatusFailedDependency {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusFailedDependency)
+		}
+
+		if location := resp.Header.Get("Location"); location != "" {
+			t.Errorf("redirected to %q after failed push", location)
+		}
+	})
+}
+
+func TestMiddlewareJWTWithRedirection_DPoP(t *testing.T) {
+	srv := authtest.NewServer(authtest.WithUser(authtest.User{Username: "user", Password: "pass"}))
+	defer srv.Close()
+
+	dpopConfig := &request.DPoPConfig{}
+	dpop, err := dpopConfig.DPoP()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := (&auth.Provider{Generic: srv.Generic(), DPoP: dpopConfig}).ActiveProvider()
+
+	for _, usePAR := range []bool{false, true} {
+		e := newRedirectEcho(t, provider, func(setting *redirect.Setting) {
+			setting.UsePAR = usePAR
+		})
+
+		var token request.TokenResponse
+		decodeCookie(t, login(t, e), &token)
+
+		if jkt, _ := auth.Confirmation(token.AccessToken)["jkt"].(string); jkt != dpop.Thumbprint() {
+			t.Errorf("use par %v: jkt = %q, want the provider's DPoP key %q", usePAR, jkt, dpop.Thumbprint())
+		}
+	}
+}
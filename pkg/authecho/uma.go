@@ -0,0 +1,242 @@
+package authecho
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/request"
+)
+
+var DisableUMACheckKey = "auth_disable_uma_check"
+
+// DefaultUMACacheDuration is the maximum duration to cache a decision of the token.
+var DefaultUMACacheDuration = 5 * time.Minute
+
+// MiddlewareUMA that checks the permission with keycloak authorization services.
+//
+// Request is mapped to "resource#scope" permission, default resource is the route path and scope is the method.
+// Decision asked to the token endpoint with the access token and cached per token.
+//
+// This middleware should be used after the JWT middleware.
+// Without token URL or audience, unless it is noop, the error is logged and requests get internal server error.
+func MiddlewareUMA(opts ...OptionUMA) echo.MiddlewareFunc {
+	options := optionsUMA{
+		cacheDuration: DefaultUMACacheDuration,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.provider != nil {
+		options.noop = options.noop || options.provider.IsNoop()
+		if options.tokenURL == "" {
+			options.tokenURL = options.provider.GetTokenURL()
+		}
+
+		if options.client == nil {
+			options.client = options.provider.HTTPClient()
+		}
+	}
+
+	var errConfig error
+	if !options.noop {
+		switch {
+		case options.tokenURL == "":
+			errConfig = fmt.Errorf("uma middleware requires token url")
+		case options.audience == "":
+			errConfig = fmt.Errorf("uma middleware requires audience")
+		}
+
+		if errConfig != nil {
+			log.Error().Err(errConfig).Msg("invalid uma middleware config")
+		}
+	}
+
+	if options.permission == nil {
+		options.permission = func(c echo.Context) string {
+			resource := options.resource
+			if resource == "" {
+				resource = c.Path()
+			}
+
+			scope := c.Request().Method
+			if options.scopes != nil {
+				scope = options.scopes[strings.ToUpper(scope)]
+			}
+
+			if scope == "" {
+				return resource
+			}
+
+			return resource + "#" + scope
+		}
+	}
+
+	authClient := request.Auth{
+		Client: options.client,
+	}
+
+	cache := newTokenCache[bool]()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if options.noop {
+				return next(c)
+			}
+
+			if v, ok := c.Get(DisableUMACheckKey).(bool); ok && v {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeyAuthNoop).(bool); ok && v {
+				return next(c)
+			}
+
+			if errConfig != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "permission check is not configured").SetInternal(errConfig)
+			}
+
+			accessToken := GetAccessToken(c)
+			if accessToken == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "token not found")
+			}
+
+			permission := options.permission(c)
+
+			key := cacheKey(accessToken, permission)
+			result, ok := cache.Get(key)
+			if !ok {
+				var err error
+				result, err = authClient.UMADecision(c.Request().Context(), request.UMATicketConfig{
+					AccessToken: accessToken,
+					Audience:    options.audience,
+					Permissions: []string{permission},
+					AuthRequestConfig: request.AuthRequestConfig{
+						TokenURL: options.tokenURL,
+					},
+				})
+				if err != nil {
+					return echo.NewHTTPError(http.StatusFailedDependency, "failed to get permission").SetInternal(err)
+				}
+
+				token, _ := c.Get(KeyToken).(*jwt.Token)
+				cache.Set(key, result, umaCacheExpire(token, options.cacheDuration))
+			}
+
+			if !result {
+				return echo.NewHTTPError(http.StatusForbidden, "permission not authorized")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// umaCacheExpire returns the expire time of the cache, not exceeding the token expiration.
+func umaCacheExpire(token *jwt.Token, d time.Duration) time.Time {
+	expire := time.Now().Add(d)
+
+	if token == nil || token.Claims == nil {
+		return expire
+	}
+
+	if exp, err := token.Claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expire) {
+		return exp.Time
+	}
+
+	return expire
+}
+
+type optionsUMA struct {
+	tokenURL      string
+	audience      string
+	resource      string
+	scopes        map[string]string
+	permission    func(c echo.Context) string
+	cacheDuration time.Duration
+	client        *http.Client
+	provider      auth.InfProviderExtra
+	noop          bool
+}
+
+type OptionUMA func(*optionsUMA)
+
+// WithUMATokenURL sets the token endpoint of the realm, required.
+func WithUMATokenURL(tokenURL string) OptionUMA {
+	return func(opts *optionsUMA) {
+		opts.tokenURL = tokenURL
+	}
+}
+
+// WithUMAAudience sets the client id of the resource server, required.
+func WithUMAAudience(audience string) OptionUMA {
+	return func(opts *optionsUMA) {
+		opts.audience = audience
+	}
+}
+
+// WithUMAResource sets the resource name, default is the route path like "/users/:id".
+func WithUMAResource(resource string) OptionUMA {
+	return func(opts *optionsUMA) {
+		opts.resource = resource
+	}
+}
+
+// WithUMAScopes sets the method to scope mapping like {"GET": "view", "POST": "create"}.
+//
+// Default scope is the method, not found methods check the resource without scope.
+func WithUMAScopes(scopes map[string]string) OptionUMA {
+	return func(opts *optionsUMA) {
+		opts.scopes = make(map[string]string, len(scopes))
+		for method, scope := range scopes {
+			opts.scopes[strings.ToUpper(method)] = scope
+		}
+	}
+}
+
+// WithUMAPermissionFunc sets the function to map request to "resource#scope" permission.
+//
+// Resource and scopes options are ignored with this option.
+func WithUMAPermissionFunc(fn func(c echo.Context) string) OptionUMA {
+	return func(opts *optionsUMA) {
+		opts.permission = fn
+	}
+}
+
+// WithUMACacheDuration sets the maximum duration to cache a decision, default is DefaultUMACacheDuration.
+func WithUMACacheDuration(d time.Duration) OptionUMA {
+	return func(opts *optionsUMA) {
+		opts.cacheDuration = d
+	}
+}
+
+// WithUMAClient sets the http client to use for the token endpoint.
+func WithUMAClient(client *http.Client) OptionUMA {
+	return func(opts *optionsUMA) {
+		opts.client = client
+	}
+}
+
+// WithUMAProvider sets the default token URL and http client from the provider.
+//
+// Calls use the provider's client policy, noop provider disables the check.
+func WithUMAProvider(provider auth.InfProviderExtra) OptionUMA {
+	return func(opts *optionsUMA) {
+		opts.provider = provider
+	}
+}
+
+// WithNoopUMA sets the noop option.
+//
+// If provider already has a noop, this one will be ignored.
+func WithNoopUMA(v bool) OptionUMA {
+	return func(opts *optionsUMA) {
+		opts.noop = v
+	}
+}
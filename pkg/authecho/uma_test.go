@@ -0,0 +1,143 @@
+package authecho
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/worldline-go/auth/request"
+)
+
+func TestMiddlewareUMA(t *testing.T) {
+	requestCount := 0
+	serverToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+
+		_ = r.ParseForm()
+		if r.Form.Get("grant_type") != request.GrantTypeUMATicket || r.Form.Get("response_mode") != "decision" {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if r.Form.Get("audience") == "test" && r.Form.Get("permission") == "/users/:id#view" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"result":true}`))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"access_denied","error_description":"not_authorized"}`))
+	}))
+	defer serverToken.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		want   int
+	}{
+		{
+			name:   "permitted",
+			method: http.MethodGet,
+			want:   1,
+		},
+		{
+			name:   "denied",
+			method: http.MethodDelete,
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestCount = 0
+			handler := HandlerFunc{}
+
+			middleware := MiddlewareUMA(
+				WithUMATokenURL(serverToken.URL),
+				WithUMAAudience("test"),
+				WithUMAScopes(map[string]string{
+					"get":    "view",
+					"delete": "delete",
+				}),
+			)
+			fn := middleware(handler.Fn)
+
+			e := echo.New()
+			echoCtx := e.NewContext(httptest.NewRequest(tt.method, "/users/1", nil), httptest.NewRecorder())
+			echoCtx.SetPath("/users/:id")
+			echoCtx.Set(KeyToken, &jwt.Token{Raw: "test-token"})
+
+			// second call should use the cache
+			_ = fn(echoCtx)
+			_ = fn(echoCtx)
+
+			if handler.Count != tt.want*2 {
+				t.Errorf("MiddlewareUMA() = %v, want %v", handler.Count, tt.want*2)
+			}
+
+			if requestCount != 1 {
+				t.Errorf("MiddlewareUMA() request count = %v, want %v", requestCount, 1)
+			}
+		})
+	}
+}
+
+func TestMiddlewareUMA_Required(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []OptionUMA
+		want int
+	}{
+		{
+			name: "no token url",
+			opts: []OptionUMA{WithUMAAudience("test")},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "no audience",
+			opts: []OptionUMA{WithUMATokenURL("http://localhost/token")},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "noop",
+			opts: []OptionUMA{WithNoopUMA(true)},
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := MiddlewareUMA(tt.opts...)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			echoCtx := e.NewContext(httptest.NewRequest(http.MethodGet, "/users/1", nil), rec)
+			echoCtx.Set(KeyToken, &jwt.Token{Raw: "test-token"})
+
+			code := rec.Code
+			if err := fn(echoCtx); err != nil {
+				var errHTTP *echo.HTTPError
+				if !errors.As(err, &errHTTP) {
+					t.Fatalf("MiddlewareUMA() error = %v", err)
+				}
+
+				code = errHTTP.Code
+			}
+
+			if code != tt.want {
+				t.Errorf("MiddlewareUMA() = %v, want %v", code, tt.want)
+			}
+		})
+	}
+}
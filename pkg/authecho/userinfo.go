@@ -0,0 +1,172 @@
+package authecho
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/claims"
+	"github.com/worldline-go/auth/request"
+)
+
+// DefaultUserInfoCacheDuration is the maximum duration to cache the userinfo of a token without expiration.
+var DefaultUserInfoCacheDuration = 5 * time.Minute
+
+// MiddlewareUserInfo gets the userinfo of the access token and merges it to the *claims.Custom.
+//
+// Values of the token are not overwritten, roles and scopes are added to the sets.
+// Userinfo is cached per token until the token expiration.
+//
+// This middleware should be used after the JWT middleware, or use WithUserInfo option of the JWT middleware.
+func MiddlewareUserInfo(opts ...OptionUserInfo) echo.MiddlewareFunc {
+	options := optionsUserInfo{
+		cacheDuration: DefaultUserInfoCacheDuration,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.provider != nil {
+		options.noop = options.noop || options.provider.IsNoop()
+		if options.userInfoURL == "" {
+			options.userInfoURL = options.provider.GetUserInfoURL()
+		}
+
+		if options.client == nil {
+			options.client = options.provider.HTTPClient()
+		}
+	}
+
+	authClient := request.Auth{
+		Client: options.client,
+	}
+
+	cache := newTokenCache[*claims.Custom]()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if options.noop {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeyAuthNoop).(bool); ok && v {
+				return next(c)
+			}
+
+			if v, ok := c.Get(KeySkipper).(bool); ok && v {
+				return next(c)
+			}
+
+			// only default claims can be merged
+			tokenClaims, ok := c.Get(KeyClaims).(*claims.Custom)
+			if !ok {
+				return next(c)
+			}
+
+			accessToken := GetAccessToken(c)
+			if accessToken == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "token not found")
+			}
+
+			key := cacheKey(accessToken)
+			info, ok := cache.Get(key)
+			if !ok {
+				body, err := authClient.UserInfo(c.Request().Context(), request.UserInfoConfig{
+					UserInfoURL: options.userInfoURL,
+					AccessToken: accessToken,
+				})
+				if err != nil {
+					var errOAuth *request.OAuthError
+					if errors.As(err, &errOAuth) && errOAuth.StatusCode == http.StatusUnauthorized {
+						return echo.NewHTTPError(http.StatusUnauthorized, "token rejected by userinfo").SetInternal(err)
+					}
+
+					return echo.NewHTTPError(http.StatusFailedDependency, "failed to get userinfo").SetInternal(err)
+				}
+
+				info = &claims.Custom{}
+				if err := json.Unmarshal(body, info); err != nil {
+					return echo.NewHTTPError(http.StatusFailedDependency, "failed to parse userinfo").SetInternal(err)
+				}
+
+				token, _ := c.Get(KeyToken).(*jwt.Token)
+				cache.Set(key, info, userInfoCacheExpire(token, options.cacheDuration))
+			}
+
+			// https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse
+			if tokenClaims.Subject != "" && info.Subject != tokenClaims.Subject {
+				return echo.NewHTTPError(http.StatusUnauthorized, "userinfo subject mismatch")
+			}
+
+			tokenClaims.Merge(info)
+
+			return next(c)
+		}
+	}
+}
+
+// userInfoCacheExpire returns the token expiration, duration is used if the token has no expiration.
+func userInfoCacheExpire(token *jwt.Token, d time.Duration) time.Time {
+	if token != nil && token.Claims != nil {
+		if exp, err := token.Claims.GetExpirationTime(); err == nil && exp != nil {
+			return exp.Time
+		}
+	}
+
+	return time.Now().Add(d)
+}
+
+type optionsUserInfo struct {
+	userInfoURL   string
+	cacheDuration time.Duration
+	client        *http.Client
+	provider      auth.InfProviderExtra
+	noop          bool
+}
+
+type OptionUserInfo func(*optionsUserInfo)
+
+// WithUserInfoURL sets the userinfo endpoint, required.
+func WithUserInfoURL(userInfoURL string) OptionUserInfo {
+	return func(opts *optionsUserInfo) {
+		opts.userInfoURL = userInfoURL
+	}
+}
+
+// WithUserInfoCacheDuration sets the maximum duration to cache the userinfo, default is DefaultUserInfoCacheDuration.
+//
+// Tokens with expiration are cached until the expiration.
+func WithUserInfoCacheDuration(d time.Duration) OptionUserInfo {
+	return func(opts *optionsUserInfo) {
+		opts.cacheDuration = d
+	}
+}
+
+// WithUserInfoClient sets the http client to use for the userinfo endpoint.
+func WithUserInfoClient(client *http.Client) OptionUserInfo {
+	return func(opts *optionsUserInfo) {
+		opts.client = client
+	}
+}
+
+// WithUserInfoProvider sets the default userinfo URL and http client from the provider.
+//
+// Calls use the provider's client policy, noop provider disables the userinfo call.
+func WithUserInfoProvider(provider auth.InfProviderExtra) OptionUserInfo {
+	return func(opts *optionsUserInfo) {
+		opts.provider = provider
+	}
+}
+
+// WithNoopUserInfo sets the noop option.
+//
+// If provider already has a noop, this one will be ignored.
+func WithNoopUserInfo(v bool) OptionUserInfo {
+	return func(opts *optionsUserInfo) {
+		opts.noop = v
+	}
+}
@@ -0,0 +1,102 @@
+package authecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/worldline-go/auth/claims"
+)
+
+func TestMiddlewareUserInfo(t *testing.T) {
+	requestCount := 0
+	serverUserInfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"sub":"test-user","email":"test@example.com","preferred_username":"other","realm_access":{"roles":["admin"]},"scope":"email"}`))
+	}))
+	defer serverUserInfo.Close()
+
+	tests := []struct {
+		name    string
+		subject string
+		want    int
+		check   func(t *testing.T, c *claims.Custom)
+	}{
+		{
+			name:    "merged",
+			subject: "test-user",
+			want:    1,
+			check: func(t *testing.T, c *claims.Custom) {
+				if c.Map["email"] != "test@example.com" {
+					t.Errorf("email = %v, want %v", c.Map["email"], "test@example.com")
+				}
+
+				if c.User != "test" || c.Map["preferred_username"] != "test" {
+					t.Errorf("user overwritten = %v", c.User)
+				}
+
+				if !c.HasRole("admin") || !c.HasRole("user") || !c.HasScope("email") {
+					t.Errorf("sets not merged, roles = %v, scopes = %v", c.RoleSet, c.ScopeSet)
+				}
+			},
+		},
+		{
+			name:    "subject mismatch",
+			subject: "another-user",
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestCount = 0
+			handler := HandlerFunc{}
+
+			fn := MiddlewareUserInfo(WithUserInfoURL(serverUserInfo.URL))(handler.Fn)
+
+			e := echo.New()
+			for i := 0; i < 2; i++ {
+				tokenClaims := &claims.Custom{
+					User:     "test",
+					RoleSet:  map[string]struct{}{"user": {}},
+					ScopeSet: map[string]struct{}{},
+					Map:      map[string]interface{}{"preferred_username": "test"},
+					RegisteredClaims: jwt.RegisteredClaims{
+						Subject: tt.subject,
+					},
+				}
+
+				echoCtx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+				echoCtx.Set(KeyToken, &jwt.Token{Raw: "test-token", Claims: tokenClaims})
+				echoCtx.Set(KeyClaims, tokenClaims)
+
+				err := fn(echoCtx)
+				if (err != nil) != (tt.want == 0) {
+					t.Fatalf("MiddlewareUserInfo() error = %v", err)
+				}
+
+				if tt.check != nil {
+					tt.check(t, tokenClaims)
+				}
+			}
+
+			if handler.Count != tt.want*2 {
+				t.Errorf("MiddlewareUserInfo() = %v, want %v", handler.Count, tt.want*2)
+			}
+
+			// second call should use the cache
+			if requestCount != 1 {
+				t.Errorf("MiddlewareUserInfo() request count = %v, want %v", requestCount, 1)
+			}
+		})
+	}
+}
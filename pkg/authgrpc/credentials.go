@@ -0,0 +1,98 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/request"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/credentials"
+)
+
+// ErrDPoPNotSupported is returned for the DPoP bound tokens, gRPC calls don't send the DPoP proofs.
+var ErrDPoPNotSupported = errors.New("dpop bound tokens are not supported by the grpc credentials")
+
+// PerRPCCredentials adds the token of the source to the metadata of the calls.
+//
+// Nil Source sends the calls without token, like the noop provider.
+type PerRPCCredentials struct {
+	Source oauth2.TokenSource
+	// Insecure allows sending the token without transport security.
+	Insecure bool
+}
+
+var _ credentials.PerRPCCredentials = PerRPCCredentials{}
+
+// NewPerRPCCredentials returns the client credentials of the provider.
+//
+//	creds, err := authgrpc.NewPerRPCCredentials(ctx, provider)
+//	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(tlsCreds), grpc.WithPerRPCCredentials(creds))
+//
+// DPoP of the provider is not supported, calls can't send the proofs.
+func NewPerRPCCredentials(ctx context.Context, provider auth.InfProviderExtra, opts ...OptionCredentials) (*PerRPCCredentials, error) {
+	shared, err := provider.NewOauth2Shared(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if shared.DPoP != nil {
+		return nil, ErrDPoPNotSupported
+	}
+
+	return NewPerRPCCredentialsShared(shared, opts...), nil
+}
+
+// NewPerRPCCredentialsShared returns the credentials with the token source of the shared.
+func NewPerRPCCredentialsShared(shared *auth.OAuth2Shared, opts ...OptionCredentials) *PerRPCCredentials {
+	var options optionsCredentials
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &PerRPCCredentials{
+		Source:   shared.Source,
+		Insecure: options.insecure,
+	}
+}
+
+// GetRequestMetadata gets the token with the context of the call if the source is an auth.TokenContextSource.
+//
+// DPoP tokens return ErrDPoPNotSupported.
+func (c PerRPCCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	if c.Source == nil {
+		return nil, nil
+	}
+
+	token, err := auth.SourceToken(ctx, c.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+
+	if strings.EqualFold(token.Type(), request.TokenTypeDPoP) {
+		return nil, ErrDPoPNotSupported
+	}
+
+	return map[string]string{
+		KeyAuthorization: token.Type() + " " + token.AccessToken,
+	}, nil
+}
+
+func (c PerRPCCredentials) RequireTransportSecurity() bool {
+	return !c.Insecure
+}
+
+type optionsCredentials struct {
+	insecure bool
+}
+
+type OptionCredentials func(*optionsCredentials)
+
+// WithInsecure allows sending the token without transport security, like in a service mesh with mTLS sidecars.
+func WithInsecure(v bool) OptionCredentials {
+	return func(opts *optionsCredentials) {
+		opts.insecure = v
+	}
+}
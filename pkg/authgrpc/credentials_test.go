@@ -0,0 +1,114 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/providers"
+	"github.com/worldline-go/auth/request"
+	"golang.org/x/oauth2"
+)
+
+func TestNewPerRPCCredentials(t *testing.T) {
+	serverToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"test-token","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer serverToken.Close()
+
+	providerConfig := auth.Provider{
+		Keycloak: &providers.KeyCloak{
+			TokenURL:     serverToken.URL,
+			ClientID:     "test",
+			ClientSecret: "test-secret",
+		},
+	}
+
+	creds, err := NewPerRPCCredentials(context.Background(), providerConfig.ActiveProvider())
+	if err != nil {
+		t.Fatalf("NewPerRPCCredentials() error = %v", err)
+	}
+
+	if !creds.RequireTransportSecurity() {
+		t.Errorf("RequireTransportSecurity() = false, want true")
+	}
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("GetRequestMetadata() error = %v", err)
+	}
+
+	if md[KeyAuthorization] != "Bearer test-token" {
+		t.Errorf("authorization = %q, want %q", md[KeyAuthorization], "Bearer test-token")
+	}
+
+	noop, err := NewPerRPCCredentials(context.Background(), auth.Noop{}, WithInsecure(true))
+	if err != nil {
+		t.Fatalf("NewPerRPCCredentials() error = %v", err)
+	}
+
+	if md, err := noop.GetRequestMetadata(context.Background()); err != nil || md != nil || noop.RequireTransportSecurity() {
+		t.Errorf("noop GetRequestMetadata() = %v, %v", md, err)
+	}
+}
+
+// blockingSource waits the context, Token never returns.
+type blockingSource struct{}
+
+func (blockingSource) Token() (*oauth2.Token, error) {
+	select {}
+}
+
+func (blockingSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func TestPerRPCCredentials_GetRequestMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  oauth2.TokenSource
+		wantErr error
+	}{
+		{
+			name:    "call deadline",
+			source:  blockingSource{},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "dpop token",
+			source:  oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token", TokenType: "DPoP"}),
+			wantErr: ErrDPoPNotSupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err := PerRPCCredentials{Source: tt.source}.GetRequestMetadata(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetRequestMetadata() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	providerConfig := auth.Provider{
+		Keycloak: &providers.KeyCloak{
+			TokenURL:     "http://localhost/token",
+			ClientID:     "test",
+			ClientSecret: "test-secret",
+		},
+		DPoP: &request.DPoPConfig{},
+	}
+
+	if _, err := NewPerRPCCredentials(context.Background(), providerConfig.ActiveProvider()); !errors.Is(err, ErrDPoPNotSupported) {
+		t.Errorf("NewPerRPCCredentials() with dpop error = %v, want %v", err, ErrDPoPNotSupported)
+	}
+}
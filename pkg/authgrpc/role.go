@@ -0,0 +1,113 @@
+package authgrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type ClaimsRole interface {
+	HasRole(role string) bool
+}
+
+// UnaryServerInterceptorRole checks the role claim, use it after UnaryServerInterceptor.
+//
+// This interceptor just work with ClaimsRole interface in claims.
+func UnaryServerInterceptorRole(opts ...OptionRole) grpc.UnaryServerInterceptor {
+	check := checkRole(opts...)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptorRole checks the role claim, use it after StreamServerInterceptor.
+func StreamServerInterceptorRole(opts ...OptionRole) grpc.StreamServerInterceptor {
+	check := checkRole(opts...)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func checkRole(opts ...OptionRole) func(ctx context.Context, fullMethod string) error {
+	var options optionsRole
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	methodSet := make(map[string]struct{}, len(options.methods))
+	for _, method := range options.methods {
+		methodSet[method] = struct{}{}
+	}
+
+	return func(ctx context.Context, fullMethod string) error {
+		if options.noop || IsNoop(ctx) {
+			return nil
+		}
+
+		if len(methodSet) > 0 {
+			if _, ok := methodSet[fullMethod]; !ok {
+				return nil
+			}
+		}
+
+		claimsV, ok := ClaimsFromContext(ctx).(ClaimsRole)
+		if !ok {
+			return status.Error(codes.Unauthenticated, "claims not found")
+		}
+
+		if len(options.roles) > 0 {
+			for _, role := range options.roles {
+				if claimsV.HasRole(role) {
+					return nil
+				}
+			}
+
+			return status.Error(codes.PermissionDenied, "role not authorized")
+		}
+
+		return nil
+	}
+}
+
+type optionsRole struct {
+	roles   []string
+	methods []string
+	noop    bool
+}
+
+type OptionRole func(*optionsRole)
+
+// WithRoles sets the roles to check, one of them is enough.
+func WithRoles(roles ...string) OptionRole {
+	return func(opts *optionsRole) {
+		opts.roles = roles
+	}
+}
+
+// WithMethodsRole sets the full method names to check, like "/package.Service/Method".
+func WithMethodsRole(methods ...string) OptionRole {
+	return func(opts *optionsRole) {
+		opts.methods = methods
+	}
+}
+
+// WithNoopRole sets the noop option.
+//
+// If provider already has a noop, this one will be ignored.
+func WithNoopRole(v bool) OptionRole {
+	return func(opts *optionsRole) {
+		opts.noop = v
+	}
+}
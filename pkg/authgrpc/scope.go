@@ -0,0 +1,113 @@
+package authgrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type ClaimsScope interface {
+	HasScope(scope string) bool
+}
+
+// UnaryServerInterceptorScope checks the scope claim, use it after UnaryServerInterceptor.
+//
+// This interceptor just work with ClaimsScope interface in claims.
+func UnaryServerInterceptorScope(opts ...OptionScope) grpc.UnaryServerInterceptor {
+	check := checkScope(opts...)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptorScope checks the scope claim, use it after StreamServerInterceptor.
+func StreamServerInterceptorScope(opts ...OptionScope) grpc.StreamServerInterceptor {
+	check := checkScope(opts...)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func checkScope(opts ...OptionScope) func(ctx context.Context, fullMethod string) error {
+	var options optionsScope
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	methodSet := make(map[string]struct{}, len(options.methods))
+	for _, method := range options.methods {
+		methodSet[method] = struct{}{}
+	}
+
+	return func(ctx context.Context, fullMethod string) error {
+		if options.noop || IsNoop(ctx) {
+			return nil
+		}
+
+		if len(methodSet) > 0 {
+			if _, ok := methodSet[fullMethod]; !ok {
+				return nil
+			}
+		}
+
+		claimsV, ok := ClaimsFromContext(ctx).(ClaimsScope)
+		if !ok {
+			return status.Error(codes.Unauthenticated, "claims not found")
+		}
+
+		if len(options.scopes) > 0 {
+			for _, scope := range options.scopes {
+				if claimsV.HasScope(scope) {
+					return nil
+				}
+			}
+
+			return status.Error(codes.PermissionDenied, "scope not authorized")
+		}
+
+		return nil
+	}
+}
+
+type optionsScope struct {
+	scopes  []string
+	methods []string
+	noop    bool
+}
+
+type OptionScope func(*optionsScope)
+
+// WithScopes sets the scopes to check, one of them is enough.
+func WithScopes(scopes ...string) OptionScope {
+	return func(opts *optionsScope) {
+		opts.scopes = scopes
+	}
+}
+
+// WithMethodsScope sets the full method names to check, like "/package.Service/Method".
+func WithMethodsScope(methods ...string) OptionScope {
+	return func(opts *optionsScope) {
+		opts.methods = methods
+	}
+}
+
+// WithNoopScope sets the noop option.
+//
+// If provider already has a noop, this one will be ignored.
+func WithNoopScope(v bool) OptionScope {
+	return func(opts *optionsScope) {
+		opts.noop = v
+	}
+}
@@ -0,0 +1,215 @@
+package authgrpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/claims"
+	"github.com/worldline-go/auth/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// KeyAuthorization is the metadata key of the token.
+var KeyAuthorization = "authorization"
+
+type (
+	ctxClaims struct{}
+	ctxToken  struct{}
+	ctxNoop   struct{}
+)
+
+// ClaimsFromContext returns the claims set by the server interceptors, default claims is *claims.Custom.
+func ClaimsFromContext(ctx context.Context) jwt.Claims {
+	v, _ := ctx.Value(ctxClaims{}).(jwt.Claims)
+
+	return v
+}
+
+// TokenFromContext returns the parsed token set by the server interceptors.
+func TokenFromContext(ctx context.Context) *jwt.Token {
+	v, _ := ctx.Value(ctxToken{}).(*jwt.Token)
+
+	return v
+}
+
+// IsNoop returns true if the server interceptors run with the noop provider.
+func IsNoop(ctx context.Context) bool {
+	v, _ := ctx.Value(ctxNoop{}).(bool)
+
+	return v
+}
+
+// UnaryServerInterceptor validates the token in the metadata and adds the claims to the context.
+//
+// Access token is also set with auth.WithAccessToken to forward it in the downstream calls.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	options := getOptions(opts...)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := options.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor validates the token in the metadata and adds the claims to the stream context.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	options := getOptions(opts...)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := options.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of the stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (o *options) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if o.skipper != nil && o.skipper(ctx, fullMethod) {
+		return ctx, nil
+	}
+
+	tokenString := tokenFromMetadata(ctx)
+
+	if o.noop {
+		ctx = context.WithValue(ctx, ctxNoop{}, true)
+
+		tokenClaims := o.newClaims()
+
+		var token *jwt.Token
+		if o.noopParser {
+			// noop parser of the provider sets the identity
+			token, _ = o.parser.ParseWithClaims(tokenString, tokenClaims)
+		} else if tokenString != "" {
+			token, _, _ = jwt.NewParser().ParseUnverified(tokenString, tokenClaims)
+		}
+
+		if token != nil {
+			ctx = context.WithValue(ctx, ctxToken{}, token)
+		}
+
+		return context.WithValue(ctx, ctxClaims{}, tokenClaims), nil
+	}
+
+	if tokenString == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing token")
+	}
+
+	if o.parser == nil {
+		return nil, status.Error(codes.Internal, "parser function not set")
+	}
+
+	tokenClaims := o.newClaims()
+	token, err := o.parser.ParseWithClaims(tokenString, tokenClaims)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	ctx = context.WithValue(ctx, ctxToken{}, token)
+	ctx = context.WithValue(ctx, ctxClaims{}, tokenClaims)
+
+	return auth.WithAccessToken(ctx, tokenString), nil
+}
+
+// tokenFromMetadata returns the Bearer token of the incoming metadata.
+func tokenFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	for _, v := range md.Get(KeyAuthorization) {
+		scheme, token, ok := strings.Cut(v, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") && token != "" {
+			return token
+		}
+	}
+
+	return ""
+}
+
+type options struct {
+	parser    models.InfKeyFuncParser
+	newClaims func() jwt.Claims
+	skipper   func(ctx context.Context, fullMethod string) bool
+
+	noop       bool
+	noopParser bool
+}
+
+type Option func(*options)
+
+func getOptions(opts ...Option) options {
+	var options options
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.newClaims == nil {
+		options.newClaims = func() jwt.Claims {
+			return &claims.Custom{}
+		}
+	}
+
+	// is it noop?
+	if options.parser != nil {
+		if v, _ := options.parser.Keyfunc(&jwt.Token{}); v == auth.NoopKey {
+			options.noop = true
+			options.noopParser = true
+		}
+	}
+
+	return options
+}
+
+// WithKeyFuncParser sets the key and parser functions of the JWKS, required.
+//
+// Noop provider's parser sets the configured identity as claims when no token is sent.
+func WithKeyFuncParser(jwks models.InfKeyFuncParser) Option {
+	return func(opts *options) {
+		opts.parser = jwks
+	}
+}
+
+// WithClaims sets the claims to use, function must return a pointer.
+func WithClaims(newClaims func() jwt.Claims) Option {
+	return func(opts *options) {
+		opts.newClaims = newClaims
+	}
+}
+
+// WithSkipper skips the validation of the methods, like health checks.
+func WithSkipper(skipper func(ctx context.Context, fullMethod string) bool) Option {
+	return func(opts *options) {
+		opts.skipper = skipper
+	}
+}
+
+// WithNoop sets the noop option.
+//
+// If provider already has a noop, this one will be ignored.
+func WithNoop(noop bool) Option {
+	return func(opts *options) {
+		opts.noop = noop
+	}
+}
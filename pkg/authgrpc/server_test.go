@@ -0,0 +1,186 @@
+package authgrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth"
+	"github.com/worldline-go/auth/claims"
+	"github.com/worldline-go/auth/providers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testParser struct{}
+
+func (testParser) Keyfunc(_ *jwt.Token) (interface{}, error) {
+	return []byte("test"), nil
+}
+
+func (p testParser) ParseWithClaims(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, p.Keyfunc)
+}
+
+func newTestToken(t *testing.T, key string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	v, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	token := newTestToken(t, "test", jwt.MapClaims{
+		"sub":          "1234",
+		"scope":        "read",
+		"realm_access": map[string]interface{}{"roles": []string{"admin"}},
+	})
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		after    []grpc.UnaryServerInterceptor
+		metadata metadata.MD
+		wantCode codes.Code
+		wantSub  string
+	}{
+		{
+			name:     "valid token",
+			opts:     []Option{WithKeyFuncParser(testParser{})},
+			metadata: metadata.Pairs("authorization", "Bearer "+token),
+			wantSub:  "1234",
+		},
+		{
+			name:     "missing token",
+			opts:     []Option{WithKeyFuncParser(testParser{})},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "invalid signature",
+			opts:     []Option{WithKeyFuncParser(testParser{})},
+			metadata: metadata.Pairs("authorization", "Bearer "+newTestToken(t, "other", jwt.MapClaims{"sub": "1234"})),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name: "skipper",
+			opts: []Option{WithKeyFuncParser(testParser{}), WithSkipper(func(_ context.Context, fullMethod string) bool {
+				return fullMethod == "/test.Service/Method"
+			})},
+		},
+		{
+			name:     "role and scope",
+			opts:     []Option{WithKeyFuncParser(testParser{})},
+			after:    []grpc.UnaryServerInterceptor{UnaryServerInterceptorRole(WithRoles("admin")), UnaryServerInterceptorScope(WithScopes("write", "read"))},
+			metadata: metadata.Pairs("authorization", "Bearer "+token),
+			wantSub:  "1234",
+		},
+		{
+			name:     "role not authorized",
+			opts:     []Option{WithKeyFuncParser(testParser{})},
+			after:    []grpc.UnaryServerInterceptor{UnaryServerInterceptorRole(WithRoles("transaction"))},
+			metadata: metadata.Pairs("authorization", "Bearer "+token),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "scope not authorized on method",
+			opts:     []Option{WithKeyFuncParser(testParser{})},
+			after:    []grpc.UnaryServerInterceptor{UnaryServerInterceptorScope(WithScopes("write"), WithMethodsScope("/test.Service/Method"))},
+			metadata: metadata.Pairs("authorization", "Bearer "+token),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:    "noop identity",
+			opts:    []Option{WithKeyFuncParser(auth.NoopJWTKey{Identity: &providers.Noop{Subject: "noop-user"}})},
+			after:   []grpc.UnaryServerInterceptor{UnaryServerInterceptorRole(WithRoles("transaction"))},
+			wantSub: "noop-user",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSub string
+			var gotAccessToken string
+
+			handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+				if v, ok := ClaimsFromContext(ctx).(*claims.Custom); ok {
+					gotSub = v.Subject
+				}
+
+				gotAccessToken = auth.AccessTokenFromContext(ctx)
+
+				return "ok", nil
+			}
+
+			interceptors := append([]grpc.UnaryServerInterceptor{UnaryServerInterceptor(tt.opts...)}, tt.after...)
+			for i := len(interceptors) - 1; i >= 0; i-- {
+				interceptor, next := interceptors[i], handler
+				handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+					return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}, next)
+				}
+			}
+
+			ctx := context.Background()
+			if tt.metadata != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.metadata)
+			}
+
+			_, err := handler(ctx, nil)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v, err = %v", got, tt.wantCode, err)
+			}
+
+			if gotSub != tt.wantSub {
+				t.Errorf("subject = %q, want %q", gotSub, tt.wantSub)
+			}
+
+			if tt.wantCode == codes.OK && tt.metadata != nil && gotAccessToken != token {
+				t.Errorf("access token not set in the context")
+			}
+		})
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	token := newTestToken(t, "test", jwt.MapClaims{"sub": "1234"})
+
+	interceptor := StreamServerInterceptor(WithKeyFuncParser(testParser{}))
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}
+
+	var gotSub string
+	handler := func(_ interface{}, ss grpc.ServerStream) error {
+		if v, ok := ClaimsFromContext(ss.Context()).(*claims.Custom); ok {
+			gotSub = v.Subject
+		}
+
+		return nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	if err := interceptor(nil, testServerStream{ctx: ctx}, info, handler); err != nil {
+		t.Fatalf("StreamServerInterceptor() error = %v", err)
+	}
+
+	if gotSub != "1234" {
+		t.Errorf("subject = %q, want %q", gotSub, "1234")
+	}
+
+	err := interceptor(nil, testServerStream{ctx: context.Background()}, info, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("StreamServerInterceptor() error = %v, want %v", err, codes.Unauthenticated)
+	}
+}
@@ -0,0 +1,254 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth/request"
+	"golang.org/x/oauth2"
+)
+
+// certificateCache keeps the latest parsed client certificate of a provider, parsed again when the content changes.
+type certificateCache struct {
+	m           sync.Mutex
+	cert        string
+	key         string
+	certificate *tls.Certificate
+}
+
+// Get returns the parsed certificate, same pointer is returned until the content changes.
+//
+// Nil cache parses the certificate in every call.
+func (c *certificateCache) Get(cert, key string) (*tls.Certificate, error) {
+	if c == nil {
+		certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
+
+		return &certificate, err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.certificate != nil && c.cert == cert && c.key == key {
+		return c.certificate, nil
+	}
+
+	certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	// previous certificate is dropped
+	c.cert, c.key, c.certificate = cert, key, &certificate
+
+	return &certificate, nil
+}
+
+// clientAuthConfig is the client authentication settings of the providers.
+type clientAuthConfig struct {
+	Method           string
+	ClientID         string
+	ClientSecret     string
+	ClientSecretFile string
+	ClientSecretEnv  string
+	TokenURL         string
+
+	AssertionKey     string
+	AssertionKeyFile string
+	AssertionKID     string
+	AssertionAlg     string
+
+	TLSCert     string
+	TLSCertFile string
+	TLSKey      string
+	TLSKeyFile  string
+
+	// certificates is the cache of the provider.
+	certificates *certificateCache
+}
+
+func (c clientAuthConfig) method() string {
+	if c.Method == "" {
+		return request.AuthMethodClientSecretBasic
+	}
+
+	return c.Method
+}
+
+// authStyle returns the oauth2 style, private_key_jwt and tls_client_auth send only client_id in params.
+func (c clientAuthConfig) authStyle() oauth2.AuthStyle {
+	if c.method() == request.AuthMethodClientSecretBasic {
+		return oauth2.AuthStyleInHeader
+	}
+
+	return oauth2.AuthStyleInParams
+}
+
+// secret returns the client secret from the file, environment variable or the value.
+func (c clientAuthConfig) secret() (string, error) {
+	v, err := secretValue(c.ClientSecret, c.ClientSecretFile, c.ClientSecretEnv)
+	if err != nil {
+		return "", fmt.Errorf("client_secret_file: %w", err)
+	}
+
+	return v, nil
+}
+
+// clientSecret returns the secret to send, empty for methods not using the secret.
+func (c clientAuthConfig) clientSecret() (string, error) {
+	if !c.usesSecret() {
+		return "", nil
+	}
+
+	return c.secret()
+}
+
+func (c clientAuthConfig) clientAuth() (*request.ClientAuth, error) {
+	ca := &request.ClientAuth{
+		Method:   c.method(),
+		ClientID: c.ClientID,
+		TokenURL: c.TokenURL,
+	}
+
+	switch ca.Method {
+	case request.AuthMethodClientSecretBasic, request.AuthMethodClientSecretPost:
+		secret, err := c.secret()
+		if err != nil {
+			return nil, err
+		}
+
+		ca.ClientSecret = secret
+	case request.AuthMethodPrivateKeyJWT:
+		assertionKey, err := fileValueOr(c.AssertionKey, c.AssertionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client_assertion_key: %w", err)
+		}
+
+		key, method, err := parseSigningKey(assertionKey, c.AssertionAlg)
+		if err != nil {
+			return nil, fmt.Errorf("client_assertion_key: %w", err)
+		}
+
+		ca.ClientAssertion = request.NewClientAssertion(method, key, c.AssertionKID)
+	case request.AuthMethodTLSClientAuth:
+		cert, err := c.tlsCertificate()
+		if err != nil {
+			return nil, fmt.Errorf("tls_client_cert: %w", err)
+		}
+
+		ca.Certificate = cert
+	default:
+		return nil, fmt.Errorf("token_endpoint_auth_method %q is not supported", ca.Method)
+	}
+
+	return ca, nil
+}
+
+// validate checks the required fields of the method.
+func (c clientAuthConfig) validate() []error {
+	var errs []error
+
+	switch c.method() {
+	case request.AuthMethodClientSecretBasic, request.AuthMethodClientSecretPost:
+		if _, err := c.secret(); err != nil {
+			errs = append(errs, err)
+		}
+	case request.AuthMethodPrivateKeyJWT:
+		if c.AssertionKey == "" && c.AssertionKeyFile == "" {
+			errs = append(errs, fmt.Errorf("client_assertion_key is required for %s", request.AuthMethodPrivateKeyJWT))
+		} else if assertionKey, err := fileValueOr(c.AssertionKey, c.AssertionKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("client_assertion_key_file: %w", err))
+		} else if _, _, err := parseSigningKey(assertionKey, c.AssertionAlg); err != nil {
+			errs = append(errs, fmt.Errorf("client_assertion_key is invalid: %w", err))
+		}
+	case request.AuthMethodTLSClientAuth:
+		if (c.TLSCert == "" && c.TLSCertFile == "") || (c.TLSKey == "" && c.TLSKeyFile == "") {
+			errs = append(errs, fmt.Errorf("tls_client_cert and tls_client_key are required for %s", request.AuthMethodTLSClientAuth))
+		} else if _, err := c.tlsCertificate(); err != nil {
+			errs = append(errs, fmt.Errorf("tls_client_cert is invalid: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("token_endpoint_auth_method %q is not supported", c.Method))
+	}
+
+	return errs
+}
+
+// tlsCertificate returns the client certificate, same pointer is returned until the content changes.
+func (c clientAuthConfig) tlsCertificate() (*tls.Certificate, error) {
+	cert, err := fileValueOr(c.TLSCert, c.TLSCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := fileValueOr(c.TLSKey, c.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.certificates.Get(cert, key)
+}
+
+// usesSecret reports the method needs the client secret.
+func (c clientAuthConfig) usesSecret() bool {
+	m := c.method()
+
+	return m == request.AuthMethodClientSecretBasic || m == request.AuthMethodClientSecretPost
+}
+
+// parseSigningKey parses PEM encoded private key and selects the signing method.
+func parseSigningKey(keyPEM, alg string) (interface{}, jwt.SigningMethod, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, nil, fmt.Errorf("PEM not found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if alg != "" {
+		method := jwt.GetSigningMethod(alg)
+		if method == nil {
+			return nil, nil, fmt.Errorf("unknown alg %q", alg)
+		}
+
+		return key, method, nil
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve.Params().BitSize {
+		case 384:
+			return k, jwt.SigningMethodES384, nil
+		case 521:
+			return k, jwt.SigningMethodES512, nil
+		default:
+			return k, jwt.SigningMethodES256, nil
+		}
+	case ed25519.PrivateKey:
+		return k, jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
@@ -0,0 +1,81 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/worldline-go/auth/request"
+)
+
+func TestGeneric_ClientAuthCertificate(t *testing.T) {
+	newCert := func(t *testing.T) (string, string) {
+		t.Helper()
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	}
+
+	p := &Generic{
+		TokenURL:                "https://localhost/token",
+		ClientID:                "test",
+		TokenEndpointAuthMethod: request.AuthMethodTLSClientAuth,
+	}
+	p.TLSClientCert, p.TLSClientKey = newCert(t)
+
+	certificate := func(t *testing.T) interface{} {
+		t.Helper()
+
+		clientAuth, err := p.ClientAuth()
+		if err != nil {
+			t.Fatalf("ClientAuth() error = %v", err)
+		}
+
+		return clientAuth.Certificate
+	}
+
+	first := certificate(t)
+	if second := certificate(t); second != first {
+		t.Fatal("certificate parsed again with the same content")
+	}
+
+	// rotated inline certificate replaces the cached one
+	p.TLSClientCert, p.TLSClientKey = newCert(t)
+
+	rotated := certificate(t)
+	if rotated == first {
+		t.Fatal("certificate not parsed again after the rotation")
+	}
+
+	if p.certificates.certificate != rotated || p.certificates.key != p.TLSClientKey {
+		t.Error("cache doesn't hold only the rotated certificate")
+	}
+}
@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// files caches the content of the secret files, re-read when the file changes.
+var files = fileCache{
+	values: make(map[string]fileValue),
+}
+
+type fileValue struct {
+	content string
+	modTime time.Time
+	size    int64
+}
+
+type fileCache struct {
+	values map[string]fileValue
+	m      sync.Mutex
+}
+
+// Read returns the content of the file, checks modification time and size to re-read.
+func (f *fileCache) Read(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if v, ok := f.values[path]; ok && v.modTime.Equal(info.ModTime()) && v.size == info.Size() {
+		return v.content, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	f.values[path] = fileValue{
+		content: string(content),
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+
+	return string(content), nil
+}
+
+// secretValue returns the value from the file or environment variable if set, otherwise the value itself.
+//
+// Secret is trimmed of spaces and new lines of the file.
+func secretValue(value, file, env string) (string, error) {
+	if file != "" {
+		v, err := files.Read(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file %s: %w", file, err)
+		}
+
+		return strings.TrimSpace(v), nil
+	}
+
+	if env != "" {
+		return os.Getenv(env), nil
+	}
+
+	return value, nil
+}
+
+// secretValueLog returns the secret value for the getters without error, read error is logged and returns empty.
+func secretValueLog(value, file, env string) string {
+	v, err := secretValue(value, file, env)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read secret file")
+
+		return ""
+	}
+
+	return v
+}
+
+// fileValueOr returns the content of the file if set, otherwise the value itself.
+func fileValueOr(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+
+	v, err := files.Read(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", file, err)
+	}
+
+	return v, nil
+}
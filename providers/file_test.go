@@ -0,0 +1,74 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGeneric_GetClientSecretFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+
+	if err := os.WriteFile(file, []byte("secret-1\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+
+	p := &Generic{
+		ClientSecret:     "not-used",
+		ClientSecretFile: file,
+	}
+
+	if got := p.GetClientSecret(); got != "secret-1" {
+		t.Errorf("Generic.GetClientSecret() = %v, want %v", got, "secret-1")
+	}
+
+	// rotate the secret
+	if err := os.WriteFile(file, []byte("secret-rotated\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+
+	if err := os.Chtimes(file, time.Now(), time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("Chtimes error = %v", err)
+	}
+
+	if got := p.GetClientSecret(); got != "secret-rotated" {
+		t.Errorf("Generic.GetClientSecret() = %v, want %v", got, "secret-rotated")
+	}
+
+	cfg, err := p.ClientConfig()
+	if err == nil {
+		t.Fatalf("Generic.ClientConfig() = %v, want tokenURL error", cfg)
+	}
+
+	p.TokenURL = "https://localhost/token"
+
+	cfg, err = p.ClientConfig()
+	if err != nil {
+		t.Fatalf("Generic.ClientConfig() error = %v", err)
+	}
+
+	if cfg.ClientSecret != "secret-rotated" {
+		t.Errorf("Generic.ClientConfig().ClientSecret = %v, want %v", cfg.ClientSecret, "secret-rotated")
+	}
+}
+
+func TestGeneric_ClientSecretFileError(t *testing.T) {
+	p := &Generic{
+		ClientID:         "test",
+		ClientSecretFile: filepath.Join(t.TempDir(), "not-exist"),
+		TokenURL:         "https://localhost/token",
+	}
+
+	if cfg, err := p.ClientConfig(); err == nil {
+		t.Errorf("Generic.ClientConfig() = %v, want read error", cfg)
+	}
+
+	if clientAuth, err := p.ClientAuth(); err == nil {
+		t.Errorf("Generic.ClientAuth() = %v, want read error", clientAuth)
+	}
+
+	if err := p.Validate(UseClientCredentials); err == nil {
+		t.Error("Generic.Validate() want read error")
+	}
+}
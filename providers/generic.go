@@ -3,7 +3,8 @@ package providers
 import (
 	"fmt"
 
-	"golang.org/x/oauth2"
+	"github.com/worldline-go/auth/models"
+	"github.com/worldline-go/auth/request"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
@@ -19,12 +20,48 @@ type Generic struct {
 	// ClientSecret is the application's secret.
 	ClientSecret string `cfg:"client_secret" log:"false"`
 
+	// ClientSecretFile is the path of the file holding the client secret, re-read when the file changes.
+	//
+	// Has priority over ClientSecret and ClientSecretEnv.
+	ClientSecretFile string `cfg:"client_secret_file"`
+
+	// ClientSecretEnv is the environment variable name holding the client secret.
+	//
+	// Has priority over ClientSecret.
+	ClientSecretEnv string `cfg:"client_secret_env"`
+
 	// ClientSecretExternal for reaching the client secret from outside.
 	ClientSecretExternal string `cfg:"client_secret_external"`
 
 	// Scope specifies optional requested permissions.
 	Scopes []string `cfg:"scopes"`
 
+	// TokenEndpointAuthMethod is the client authentication method to the token endpoint.
+	//
+	// Values are client_secret_basic, client_secret_post, private_key_jwt and tls_client_auth.
+	// Default is client_secret_basic.
+	TokenEndpointAuthMethod string `cfg:"token_endpoint_auth_method"`
+	// ClientAssertionKey is the PEM encoded private key to sign the client assertion of private_key_jwt.
+	ClientAssertionKey string `cfg:"client_assertion_key" log:"false"`
+	// ClientAssertionKeyFile is the path of the PEM encoded private key, has priority over ClientAssertionKey.
+	//
+	// File is re-read when it changes.
+	ClientAssertionKeyFile string `cfg:"client_assertion_key_file"`
+	// ClientAssertionKID is the key id of the ClientAssertionKey.
+	ClientAssertionKID string `cfg:"client_assertion_kid"`
+	// ClientAssertionAlg is the signing algorithm of the client assertion.
+	//
+	// Default is based on the key type, RS256, ES256/ES384/ES512 or EdDSA.
+	ClientAssertionAlg string `cfg:"client_assertion_alg"`
+	// TLSClientCert is the PEM encoded client certificate of tls_client_auth.
+	TLSClientCert string `cfg:"tls_client_cert"`
+	// TLSClientKey is the PEM encoded private key of the TLSClientCert.
+	TLSClientKey string `cfg:"tls_client_key" log:"false"`
+	// TLSClientCertFile is the path of the PEM encoded client certificate, has priority over TLSClientCert.
+	TLSClientCertFile string `cfg:"tls_client_cert_file"`
+	// TLSClientKeyFile is the path of the PEM encoded private key, has priority over TLSClientKey.
+	TLSClientKeyFile string `cfg:"tls_client_key_file"`
+
 	// End of extra settings for clients.
 
 	// CertURL is the resource server's public key URL.
@@ -57,10 +94,29 @@ type Generic struct {
 	// Default is TokenURL.
 	TokenURLExternal string `cfg:"token_url_external"`
 
+	// LogoutURL is the end session endpoint.
 	LogoutURL string `cfg:"logout_url"`
 	// LogoutURLExternal for reaching the logout url from outside.
 	// Default is LogoutURL.
 	LogoutURLExternal string `cfg:"logout_url_external"`
+
+	// UserInfoURL is the OpenID Connect userinfo endpoint.
+	UserInfoURL string `cfg:"userinfo_url"`
+	// UserInfoURLExternal for reaching the userinfo url from outside.
+	//
+	// Default is UserInfoURL.
+	UserInfoURLExternal string `cfg:"userinfo_url_external"`
+
+	// RevocationURL is the token revocation endpoint, RFC 7009.
+	RevocationURL string `cfg:"revocation_url"`
+
+	// DeviceAuthURL is the device authorization endpoint, RFC 8628.
+	DeviceAuthURL string `cfg:"device_auth_url"`
+
+	// PARURL is the pushed authorization request endpoint, RFC 9126.
+	PARURL string `cfg:"par_url"`
+
+	certificates certificateCache
 }
 
 func (p *Generic) GetLogoutURL() string {
@@ -75,6 +131,30 @@ func (p *Generic) GetLogoutURLExternal() string {
 	return p.LogoutURL
 }
 
+func (p *Generic) GetUserInfoURL() string {
+	return p.UserInfoURL
+}
+
+func (p *Generic) GetUserInfoURLExternal() string {
+	if p.UserInfoURLExternal != "" {
+		return p.UserInfoURLExternal
+	}
+
+	return p.UserInfoURL
+}
+
+func (p *Generic) GetRevocationURL() string {
+	return p.RevocationURL
+}
+
+func (p *Generic) GetDeviceAuthURL() string {
+	return p.DeviceAuthURL
+}
+
+func (p *Generic) GetPARURL() string {
+	return p.PARURL
+}
+
 func (p *Generic) GetIntrospectURL() string {
 	return p.IntrospectURL
 }
@@ -119,25 +199,146 @@ func (p *Generic) GetClientIDExternal() string {
 	return p.ClientIDExternal
 }
 
+// GetClientSecret returns the client secret from the file, environment variable or the value.
+//
+// Read error of the file is logged and returns empty, ClientConfig and ClientAuth return the error.
 func (p *Generic) GetClientSecret() string {
-	return p.ClientSecret
+	return secretValueLog(p.ClientSecret, p.ClientSecretFile, p.ClientSecretEnv)
 }
 
 func (p *Generic) GetClientSecretExternal() string {
 	return p.ClientSecretExternal
 }
 
+func (p *Generic) GetTokenEndpointAuthMethod() string {
+	return p.clientAuthConfig().method()
+}
+
+// ClientConfig returns the client credentials config.
+//
+// For private_key_jwt and tls_client_auth, use with the http client of ClientAuth.
 func (p *Generic) ClientConfig() (*clientcredentials.Config, error) {
 	tokenURL := p.GetTokenURL()
 	if tokenURL == "" {
 		return nil, fmt.Errorf("tokenURL empty")
 	}
 
+	cfg := p.clientAuthConfig()
+
+	clientSecret, err := cfg.clientSecret()
+	if err != nil {
+		return nil, err
+	}
+
 	return &clientcredentials.Config{
 		ClientID:     p.ClientID,
-		ClientSecret: p.ClientSecret,
-		TokenURL:     p.TokenURL,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
 		Scopes:       p.Scopes,
-		AuthStyle:    oauth2.AuthStyleInHeader,
+		AuthStyle:    cfg.authStyle(),
 	}, nil
 }
+
+// ClientAuth returns the client authentication of the TokenEndpointAuthMethod.
+func (p *Generic) ClientAuth() (*request.ClientAuth, error) {
+	return p.clientAuthConfig().clientAuth()
+}
+
+func (p *Generic) clientAuthConfig() clientAuthConfig {
+	return clientAuthConfig{
+		Method:           p.TokenEndpointAuthMethod,
+		ClientID:         p.ClientID,
+		ClientSecret:     p.ClientSecret,
+		ClientSecretFile: p.ClientSecretFile,
+		ClientSecretEnv:  p.ClientSecretEnv,
+		TokenURL:         p.GetTokenURL(),
+
+		AssertionKey:     p.ClientAssertionKey,
+		AssertionKeyFile: p.ClientAssertionKeyFile,
+		AssertionKID:     p.ClientAssertionKID,
+		AssertionAlg:     p.ClientAssertionAlg,
+
+		TLSCert:     p.TLSClientCert,
+		TLSCertFile: p.TLSClientCertFile,
+		TLSKey:      p.TLSClientKey,
+		TLSKeyFile:  p.TLSClientKeyFile,
+
+		certificates: &p.certificates,
+	}
+}
+
+// Validate checks the URL fields and required fields for the intended uses.
+//
+// Returns all problems at once as models.Errors.
+func (p *Generic) Validate(uses ...Use) error {
+	errs := models.Errors(validateURLs(
+		"cert_url", p.CertURL,
+		"introspect_url", p.IntrospectURL,
+		"auth_url", p.AuthURL,
+		"auth_url_external", p.AuthURLExternal,
+		"token_url", p.TokenURL,
+		"token_url_external", p.TokenURLExternal,
+		"logout_url", p.LogoutURL,
+		"logout_url_external", p.LogoutURLExternal,
+		"userinfo_url", p.UserInfoURL,
+		"userinfo_url_external", p.UserInfoURLExternal,
+		"revocation_url", p.RevocationURL,
+		"device_auth_url", p.DeviceAuthURL,
+		"par_url", p.PARURL,
+	))
+
+	clientAuth := clientAuthConfig{
+		Method:           p.TokenEndpointAuthMethod,
+		ClientSecret:     p.ClientSecret,
+		ClientSecretFile: p.ClientSecretFile,
+		ClientSecretEnv:  p.ClientSecretEnv,
+		AssertionKey:     p.ClientAssertionKey,
+		AssertionKeyFile: p.ClientAssertionKeyFile,
+		AssertionAlg:     p.ClientAssertionAlg,
+		TLSCert:          p.TLSClientCert,
+		TLSCertFile:      p.TLSClientCertFile,
+		TLSKey:           p.TLSClientKey,
+		TLSKeyFile:       p.TLSClientKeyFile,
+	}
+	errs = append(errs, clientAuth.validate()...)
+
+	for _, use := range uses {
+		switch use {
+		case UseResourceServer:
+			if p.CertURL == "" {
+				errs = append(errs, fmt.Errorf("cert_url is required for %s", use))
+			}
+		case UseIntrospect:
+			if p.IntrospectURL == "" {
+				errs = append(errs, fmt.Errorf("introspect_url is required for %s", use))
+			}
+			if p.ClientID == "" {
+				errs = append(errs, fmt.Errorf("client_id is required for %s", use))
+			}
+		case UseClientCredentials:
+			if p.TokenURL == "" {
+				errs = append(errs, fmt.Errorf("token_url is required for %s", use))
+			}
+			if p.ClientID == "" {
+				errs = append(errs, fmt.Errorf("client_id is required for %s", use))
+			}
+			if v, err := clientAuth.clientSecret(); err == nil && clientAuth.usesSecret() && v == "" {
+				errs = append(errs, fmt.Errorf("client_secret is required for %s", use))
+			}
+		case UseRedirect:
+			if p.AuthURL == "" {
+				errs = append(errs, fmt.Errorf("auth_url is required for %s", use))
+			}
+			if p.TokenURL == "" {
+				errs = append(errs, fmt.Errorf("token_url is required for %s", use))
+			}
+			if p.ClientID == "" {
+				errs = append(errs, fmt.Errorf("client_id is required for %s", use))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unknown use %q", use))
+		}
+	}
+
+	return errs.Err()
+}
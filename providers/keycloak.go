@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"net/url"
 	"path"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
-	"golang.org/x/oauth2"
+	"github.com/worldline-go/auth/models"
+	"github.com/worldline-go/auth/request"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
@@ -22,12 +26,48 @@ type KeyCloak struct {
 	// ClientSecret is the application's secret.
 	ClientSecret string `cfg:"client_secret" log:"false"`
 
+	// ClientSecretFile is the path of the file holding the client secret, re-read when the file changes.
+	//
+	// Has priority over ClientSecret and ClientSecretEnv.
+	ClientSecretFile string `cfg:"client_secret_file"`
+
+	// ClientSecretEnv is the environment variable name holding the client secret.
+	//
+	// Has priority over ClientSecret.
+	ClientSecretEnv string `cfg:"client_secret_env"`
+
 	// ClientSecretExternal for reaching the client secret from outside.
 	ClientSecretExternal string `cfg:"client_secret_external"`
 
 	// Scope specifies optional requested permissions.
 	Scopes []string `cfg:"scopes"`
 
+	// TokenEndpointAuthMethod is the client authentication method to the token endpoint.
+	//
+	// Values are client_secret_basic, client_secret_post, private_key_jwt and tls_client_auth.
+	// Default is client_secret_basic.
+	TokenEndpointAuthMethod string `cfg:"token_endpoint_auth_method"`
+	// ClientAssertionKey is the PEM encoded private key to sign the client assertion of private_key_jwt.
+	ClientAssertionKey string `cfg:"client_assertion_key" log:"false"`
+	// ClientAssertionKeyFile is the path of the PEM encoded private key, has priority over ClientAssertionKey.
+	//
+	// File is re-read when it changes.
+	ClientAssertionKeyFile string `cfg:"client_assertion_key_file"`
+	// ClientAssertionKID is the key id of the ClientAssertionKey.
+	ClientAssertionKID string `cfg:"client_assertion_kid"`
+	// ClientAssertionAlg is the signing algorithm of the client assertion.
+	//
+	// Default is based on the key type, RS256, ES256/ES384/ES512 or EdDSA.
+	ClientAssertionAlg string `cfg:"client_assertion_alg"`
+	// TLSClientCert is the PEM encoded client certificate of tls_client_auth.
+	TLSClientCert string `cfg:"tls_client_cert"`
+	// TLSClientKey is the PEM encoded private key of the TLSClientCert.
+	TLSClientKey string `cfg:"tls_client_key" log:"false"`
+	// TLSClientCertFile is the path of the PEM encoded client certificate, has priority over TLSClientCert.
+	TLSClientCertFile string `cfg:"tls_client_cert_file"`
+	// TLSClientKeyFile is the path of the PEM encoded private key, has priority over TLSClientKey.
+	TLSClientKeyFile string `cfg:"tls_client_key_file"`
+
 	// End of extra settings for clients.
 
 	// CertURL is the resource server's public key URL.
@@ -70,12 +110,49 @@ type KeyCloak struct {
 	// Default is BaseURL.
 	BaseURLExternal string `cfg:"base_url_external"`
 
+	// LogoutURL is the end session endpoint.
 	LogoutURL string `cfg:"logout_url"`
 	// LogoutURLExternal for reaching the logout url from outside.
 	// Default is LogoutURL.
 	LogoutURLExternal string `cfg:"logout_url_external"`
+
+	// UserInfoURL is the OpenID Connect userinfo endpoint.
+	//
+	// BaseURL and REALM are used to construct the UserInfoURL.
+	UserInfoURL string `cfg:"userinfo_url"`
+	// UserInfoURLExternal for reaching the userinfo url from outside.
+	//
+	// Default is UserInfoURL.
+	UserInfoURLExternal string `cfg:"userinfo_url_external"`
+
+	// RevocationURL is the token revocation endpoint, RFC 7009.
+	//
+	// BaseURL and REALM are used to construct the RevocationURL.
+	RevocationURL string `cfg:"revocation_url"`
+
+	// DeviceAuthURL is the device authorization endpoint, RFC 8628.
+	//
+	// BaseURL and REALM are used to construct the DeviceAuthURL.
+	DeviceAuthURL string `cfg:"device_auth_url"`
+
+	// PARURL is the pushed authorization request endpoint, RFC 9126.
+	//
+	// BaseURL and REALM are used to construct the PARURL.
+	PARURL string `cfg:"par_url"`
+
 	// Realm is the resource server's realm like master.
 	Realm string `cfg:"realm"`
+
+	// RealmAllow is a regex to allow realms for multi-realm usage, like "tenant-.*".
+	//
+	// It must match the whole realm name and it is required to accept realms from the issuer.
+	RealmAllow string `cfg:"realm_allow"`
+
+	realmAllowRgx  *regexp.Regexp
+	realmAllowErr  error
+	realmAllowOnce sync.Once
+
+	certificates certificateCache
 }
 
 func (p *KeyCloak) GetLogoutURL() string {
@@ -83,7 +160,7 @@ func (p *KeyCloak) GetLogoutURL() string {
 		return p.LogoutURL
 	}
 
-	logoutURL, err := p.getLogoutURL(p.BaseURL, p.Realm)
+	logoutURL, err := p.getRealmURL(p.BaseURL, p.Realm, "protocol/openid-connect/logout")
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get LogoutURL")
 		return ""
@@ -103,7 +180,7 @@ func (p *KeyCloak) GetLogoutURLExternal() string {
 		baseURL = p.BaseURL
 	}
 
-	logoutURL, err := p.getLogoutURL(baseURL, p.Realm)
+	logoutURL, err := p.getRealmURL(baseURL, p.Realm, "protocol/openid-connect/logout")
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get LogoutURL external")
 		return ""
@@ -132,7 +209,7 @@ func (p *KeyCloak) GetAuthURL() string {
 		return p.AuthURL
 	}
 
-	authURL, err := p.getAuthURL(p.BaseURL, p.Realm)
+	authURL, err := p.getRealmURL(p.BaseURL, p.Realm, "protocol/openid-connect/auth")
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get AuthURL")
 		return ""
@@ -152,7 +229,7 @@ func (p *KeyCloak) GetAuthURLExternal() string {
 		baseURL = p.BaseURL
 	}
 
-	authURL, err := p.getAuthURL(baseURL, p.Realm)
+	authURL, err := p.getRealmURL(baseURL, p.Realm, "protocol/openid-connect/auth")
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get AuthURL external")
 		return ""
@@ -167,7 +244,7 @@ func (p *KeyCloak) GetTokenURL() string {
 		return p.TokenURL
 	}
 
-	tokenURL, err := p.getTokenURL(p.BaseURL, p.Realm)
+	tokenURL, err := p.getRealmURL(p.BaseURL, p.Realm, "protocol/openid-connect/token")
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get TokenURL")
 		return ""
@@ -187,7 +264,7 @@ func (p *KeyCloak) GetTokenURLExternal() string {
 		baseURL = p.BaseURL
 	}
 
-	tokenURL, err := p.getTokenURL(baseURL, p.Realm)
+	tokenURL, err := p.getRealmURL(baseURL, p.Realm, "protocol/openid-connect/token")
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get TokenURL external")
 		return ""
@@ -205,60 +282,156 @@ func (p *KeyCloak) GetClientIDExternal() string {
 	return p.ClientIDExternal
 }
 
+// GetClientSecret returns the client secret from the file, environment variable or the value.
+//
+// Read error of the file is logged and returns empty, ClientConfig and ClientAuth return the error.
 func (p *KeyCloak) GetClientSecret() string {
-	return p.ClientSecret
+	return secretValueLog(p.ClientSecret, p.ClientSecretFile, p.ClientSecretEnv)
 }
 
 func (p *KeyCloak) GetClientSecretExternal() string {
 	return p.ClientSecretExternal
 }
 
+func (p *KeyCloak) GetTokenEndpointAuthMethod() string {
+	return p.clientAuthConfig().method()
+}
+
+// ClientConfig returns the client credentials config.
+//
+// For private_key_jwt and tls_client_auth, use with the http client of ClientAuth.
 func (p *KeyCloak) ClientConfig() (*clientcredentials.Config, error) {
 	tokenURL := p.GetTokenURL()
 	if tokenURL == "" {
 		return nil, fmt.Errorf("tokenURL empty")
 	}
 
+	cfg := p.clientAuthConfig()
+
+	clientSecret, err := cfg.clientSecret()
+	if err != nil {
+		return nil, err
+	}
+
 	return &clientcredentials.Config{
 		ClientID:     p.ClientID,
-		ClientSecret: p.ClientSecret,
-		TokenURL:     p.TokenURL,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
 		Scopes:       p.Scopes,
-		AuthStyle:    oauth2.AuthStyleInHeader,
+		AuthStyle:    cfg.authStyle(),
 	}, nil
 }
 
-func (p *KeyCloak) getLogoutURL(baseURL, realm string) (string, error) {
-	if baseURL == "" || realm == "" {
-		return "", fmt.Errorf("base_url and realm are required")
+// ClientAuth returns the client authentication of the TokenEndpointAuthMethod.
+func (p *KeyCloak) ClientAuth() (*request.ClientAuth, error) {
+	return p.clientAuthConfig().clientAuth()
+}
+
+func (p *KeyCloak) clientAuthConfig() clientAuthConfig {
+	return clientAuthConfig{
+		Method:           p.TokenEndpointAuthMethod,
+		ClientID:         p.ClientID,
+		ClientSecret:     p.ClientSecret,
+		ClientSecretFile: p.ClientSecretFile,
+		ClientSecretEnv:  p.ClientSecretEnv,
+		TokenURL:         p.GetTokenURL(),
+
+		AssertionKey:     p.ClientAssertionKey,
+		AssertionKeyFile: p.ClientAssertionKeyFile,
+		AssertionKID:     p.ClientAssertionKID,
+		AssertionAlg:     p.ClientAssertionAlg,
+
+		TLSCert:     p.TLSClientCert,
+		TLSCertFile: p.TLSClientCertFile,
+		TLSKey:      p.TLSClientKey,
+		TLSKeyFile:  p.TLSClientKeyFile,
+
+		certificates: &p.certificates,
 	}
+}
 
-	parsedURL, err := url.Parse(baseURL)
+func (p *KeyCloak) GetUserInfoURL() string {
+	if p.UserInfoURL != "" {
+		return p.UserInfoURL
+	}
+
+	userInfoURL, err := p.getRealmURL(p.BaseURL, p.Realm, "protocol/openid-connect/userinfo")
 	if err != nil {
-		return "", fmt.Errorf("base_url is invalid: %s", err)
+		log.Error().Err(err).Msg("failed to get UserInfoURL")
+		return ""
 	}
 
-	parsedURL.Path = path.Join(parsedURL.Path, "realms", realm, "protocol/openid-connect/logout")
+	p.UserInfoURL = userInfoURL
+	return p.UserInfoURL
+}
 
-	return parsedURL.String(), nil
+func (p *KeyCloak) GetUserInfoURLExternal() string {
+	if p.UserInfoURLExternal != "" {
+		return p.UserInfoURLExternal
+	}
+
+	baseURL := p.BaseURLExternal
+	if baseURL == "" {
+		baseURL = p.BaseURL
+	}
+
+	userInfoURL, err := p.getRealmURL(baseURL, p.Realm, "protocol/openid-connect/userinfo")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get UserInfoURL external")
+		return ""
+	}
+
+	p.UserInfoURLExternal = userInfoURL
+	return p.UserInfoURLExternal
 }
 
-func (p *KeyCloak) getTokenURL(baseURL, realm string) (string, error) {
-	if baseURL == "" || realm == "" {
-		return "", fmt.Errorf("base_url and realm are required")
+func (p *KeyCloak) GetRevocationURL() string {
+	if p.RevocationURL != "" {
+		return p.RevocationURL
 	}
 
-	parsedURL, err := url.Parse(baseURL)
+	revocationURL, err := p.getRealmURL(p.BaseURL, p.Realm, "protocol/openid-connect/revoke")
 	if err != nil {
-		return "", fmt.Errorf("base_url is invalid: %s", err)
+		log.Error().Err(err).Msg("failed to get RevocationURL")
+		return ""
 	}
 
-	parsedURL.Path = path.Join(parsedURL.Path, "realms", realm, "protocol/openid-connect/token")
+	p.RevocationURL = revocationURL
+	return p.RevocationURL
+}
 
-	return parsedURL.String(), nil
+func (p *KeyCloak) GetDeviceAuthURL() string {
+	if p.DeviceAuthURL != "" {
+		return p.DeviceAuthURL
+	}
+
+	deviceAuthURL, err := p.getRealmURL(p.BaseURL, p.Realm, "protocol/openid-connect/auth/device")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get DeviceAuthURL")
+		return ""
+	}
+
+	p.DeviceAuthURL = deviceAuthURL
+	return p.DeviceAuthURL
 }
 
-func (p *KeyCloak) getAuthURL(baseURL, realm string) (string, error) {
+func (p *KeyCloak) GetPARURL() string {
+	if p.PARURL != "" {
+		return p.PARURL
+	}
+
+	parURL, err := p.getRealmURL(p.BaseURL, p.Realm, "protocol/openid-connect/ext/par/request")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get PARURL")
+		return ""
+	}
+
+	p.PARURL = parURL
+	return p.PARURL
+}
+
+// getRealmURL returns the realm's endpoint URL like baseURL/realms/realm/protocol/openid-connect/token.
+func (p *KeyCloak) getRealmURL(baseURL, realm, endpoint string) (string, error) {
 	if baseURL == "" || realm == "" {
 		return "", fmt.Errorf("base_url and realm are required")
 	}
@@ -268,7 +441,7 @@ func (p *KeyCloak) getAuthURL(baseURL, realm string) (string, error) {
 		return "", fmt.Errorf("base_url is invalid: %s", err)
 	}
 
-	parsedURL.Path = path.Join(parsedURL.Path, "realms", realm, "protocol/openid-connect/auth")
+	parsedURL.Path = path.Join(parsedURL.Path, "realms", realm, endpoint)
 
 	return parsedURL.String(), nil
 }
@@ -278,18 +451,167 @@ func (p *KeyCloak) setCertURL() error {
 		return nil
 	}
 
-	if p.BaseURL == "" || p.Realm == "" {
-		return fmt.Errorf("base_url and realm are required")
+	certURL, err := p.getRealmURL(p.BaseURL, p.Realm, "protocol/openid-connect/certs")
+	if err != nil {
+		return err
 	}
 
-	parsedURL, err := url.Parse(p.BaseURL)
-	if err != nil {
-		return fmt.Errorf("base_url is invalid: %s", err)
+	p.CertURL = certURL
+
+	return nil
+}
+
+// GetCertURLRealm returns the cert URL of the given realm based on the BaseURL.
+func (p *KeyCloak) GetCertURLRealm(realm string) (string, error) {
+	return p.getRealmURL(p.BaseURL, realm, "protocol/openid-connect/certs")
+}
+
+// GetRealmFromIssuer returns the realm name of the issuer.
+//
+// Issuer must be under the BaseURL or BaseURLExternal like https://keycloak:8080/realms/master
+// and realm must match with RealmAllow.
+func (p *KeyCloak) GetRealmFromIssuer(issuer string) (string, error) {
+	if p.BaseURL == "" {
+		return "", fmt.Errorf("base_url is required")
 	}
 
-	parsedURL.Path = path.Join(parsedURL.Path, "realms", p.Realm, "protocol/openid-connect/certs")
+	realm := ""
+	for _, baseURL := range []string{p.BaseURL, p.BaseURLExternal} {
+		if baseURL == "" {
+			continue
+		}
 
-	p.CertURL = parsedURL.String()
+		prefix := strings.TrimSuffix(baseURL, "/") + "/realms/"
+		if v := strings.TrimPrefix(issuer, prefix); v != issuer {
+			realm = v
 
-	return nil
+			break
+		}
+	}
+
+	if realm == "" {
+		return "", fmt.Errorf("issuer %q is not under base_url", issuer)
+	}
+
+	if !realmNameRgx.MatchString(realm) || realm == "." || realm == ".." {
+		return "", fmt.Errorf("realm %q is invalid", realm)
+	}
+
+	if p.RealmAllow == "" {
+		return "", fmt.Errorf("realm_allow is required to accept realms from the issuer")
+	}
+
+	p.realmAllowOnce.Do(func() {
+		p.realmAllowRgx, p.realmAllowErr = compileRealmAllow(p.RealmAllow)
+	})
+
+	if p.realmAllowErr != nil {
+		return "", fmt.Errorf("realm_allow is invalid: %w", p.realmAllowErr)
+	}
+
+	if !p.realmAllowRgx.MatchString(realm) {
+		return "", fmt.Errorf("realm %q is not allowed", realm)
+	}
+
+	return realm, nil
+}
+
+// GetRealmAllow returns the RealmAllow pattern, empty means no realm accepted from the issuer.
+func (p *KeyCloak) GetRealmAllow() string {
+	return p.RealmAllow
+}
+
+// realmNameRgx is the allowed characters of a realm name taken from the issuer.
+var realmNameRgx = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// compileRealmAllow compiles the pattern to match the whole realm name.
+func compileRealmAllow(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// Validate checks the URL fields and required fields for the intended uses.
+//
+// Returns all problems at once as models.Errors.
+func (p *KeyCloak) Validate(uses ...Use) error {
+	errs := models.Errors(validateURLs(
+		"base_url", p.BaseURL,
+		"base_url_external", p.BaseURLExternal,
+		"cert_url", p.CertURL,
+		"introspect_url", p.IntrospectURL,
+		"auth_url", p.AuthURL,
+		"auth_url_external", p.AuthURLExternal,
+		"token_url", p.TokenURL,
+		"token_url_external", p.TokenURLExternal,
+		"logout_url", p.LogoutURL,
+		"logout_url_external", p.LogoutURLExternal,
+		"userinfo_url", p.UserInfoURL,
+		"userinfo_url_external", p.UserInfoURLExternal,
+		"revocation_url", p.RevocationURL,
+		"device_auth_url", p.DeviceAuthURL,
+		"par_url", p.PARURL,
+	))
+
+	if p.RealmAllow != "" {
+		if _, err := compileRealmAllow(p.RealmAllow); err != nil {
+			errs = append(errs, fmt.Errorf("realm_allow is invalid: %w", err))
+		}
+	}
+
+	// derived URLs need base_url and realm
+	hasRealm := p.BaseURL != "" && p.Realm != ""
+
+	clientAuth := clientAuthConfig{
+		Method:           p.TokenEndpointAuthMethod,
+		ClientSecret:     p.ClientSecret,
+		ClientSecretFile: p.ClientSecretFile,
+		ClientSecretEnv:  p.ClientSecretEnv,
+		AssertionKey:     p.ClientAssertionKey,
+		AssertionKeyFile: p.ClientAssertionKeyFile,
+		AssertionAlg:     p.ClientAssertionAlg,
+		TLSCert:          p.TLSClientCert,
+		TLSCertFile:      p.TLSClientCertFile,
+		TLSKey:           p.TLSClientKey,
+		TLSKeyFile:       p.TLSClientKeyFile,
+	}
+	errs = append(errs, clientAuth.validate()...)
+
+	for _, use := range uses {
+		switch use {
+		case UseResourceServer:
+			if p.CertURL == "" && !hasRealm {
+				errs = append(errs, fmt.Errorf("cert_url or base_url and realm are required for %s", use))
+			}
+		case UseIntrospect:
+			if p.IntrospectURL == "" {
+				errs = append(errs, fmt.Errorf("introspect_url is required for %s", use))
+			}
+			if p.ClientID == "" {
+				errs = append(errs, fmt.Errorf("client_id is required for %s", use))
+			}
+		case UseClientCredentials:
+			if p.TokenURL == "" && !hasRealm {
+				errs = append(errs, fmt.Errorf("token_url or base_url and realm are required for %s", use))
+			}
+			if p.ClientID == "" {
+				errs = append(errs, fmt.Errorf("client_id is required for %s", use))
+			}
+			if v, err := clientAuth.clientSecret(); err == nil && clientAuth.usesSecret() && v == "" {
+				errs = append(errs, fmt.Errorf("client_secret is required for %s", use))
+			}
+		case UseRedirect:
+			if p.AuthURL == "" && !hasRealm {
+				errs = append(errs, fmt.Errorf("auth_url or base_url and realm are required for %s", use))
+			}
+			if p.TokenURL == "" && !hasRealm {
+				errs = append(errs, fmt.Errorf("token_url or base_url and realm are required for %s", use))
+			}
+			if p.ClientID == "" {
+				errs = append(errs, fmt.Errorf("client_id is required for %s", use))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unknown use %q", use))
+		}
+	}
+
+	return errs.Err()
 }
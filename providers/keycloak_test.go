@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/go-test/deep"
+	"github.com/worldline-go/auth/models"
 )
 
 func TestKeyCloak_GetAuthURL(t *testing.T) {
@@ -17,6 +18,12 @@ func TestKeyCloak_GetAuthURL(t *testing.T) {
 		ClientSecret     string
 		IntrospectURL    string
 		Scopes           []string
+
+		UserInfoURL         string
+		UserInfoURLExternal string
+		RevocationURL       string
+		DeviceAuthURL       string
+		PARURL              string
 	}
 	type fields struct {
 		ClientID         string
@@ -54,6 +61,12 @@ func TestKeyCloak_GetAuthURL(t *testing.T) {
 				ClientSecret:     "",
 				IntrospectURL:    "",
 				Scopes:           nil,
+
+				UserInfoURL:         "https://keycloak/auth/realms/test/protocol/openid-connect/userinfo",
+				UserInfoURLExternal: "https://keycloak.example.com/auth/realms/test/protocol/openid-connect/userinfo",
+				RevocationURL:       "https://keycloak/auth/realms/test/protocol/openid-connect/revoke",
+				DeviceAuthURL:       "https://keycloak/auth/realms/test/protocol/openid-connect/auth/device",
+				PARURL:              "https://keycloak/auth/realms/test/protocol/openid-connect/ext/par/request",
 			},
 		},
 	}
@@ -100,6 +113,198 @@ func TestKeyCloak_GetAuthURL(t *testing.T) {
 			if diff := deep.Equal(p.GetScopes(), tt.want.Scopes); diff != nil {
 				t.Errorf("KeyCloak.GetScopes() = %v", diff)
 			}
+			if got := p.GetUserInfoURL(); got != tt.want.UserInfoURL {
+				t.Errorf("KeyCloak.GetUserInfoURL() = %v, want %v", got, tt.want.UserInfoURL)
+			}
+			if got := p.GetUserInfoURLExternal(); got != tt.want.UserInfoURLExternal {
+				t.Errorf("KeyCloak.GetUserInfoURLExternal() = %v, want %v", got, tt.want.UserInfoURLExternal)
+			}
+			if got := p.GetRevocationURL(); got != tt.want.RevocationURL {
+				t.Errorf("KeyCloak.GetRevocationURL() = %v, want %v", got, tt.want.RevocationURL)
+			}
+			if got := p.GetDeviceAuthURL(); got != tt.want.DeviceAuthURL {
+				t.Errorf("KeyCloak.GetDeviceAuthURL() = %v, want %v", got, tt.want.DeviceAuthURL)
+			}
+			if got := p.GetPARURL(); got != tt.want.PARURL {
+				t.Errorf("KeyCloak.GetPARURL() = %v, want %v", got, tt.want.PARURL)
+			}
+		})
+	}
+}
+
+func TestKeyCloak_GetRealmFromIssuer(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *KeyCloak
+		issuer   string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "base url",
+			provider: &KeyCloak{
+				BaseURL:    "https://keycloak/auth/",
+				RealmAllow: ".*",
+			},
+			issuer: "https://keycloak/auth/realms/tenant-1",
+			want:   "tenant-1",
+		},
+		{
+			name: "base url external",
+			provider: &KeyCloak{
+				BaseURL:         "https://keycloak/auth",
+				BaseURLExternal: "https://keycloak.example.com/auth",
+				RealmAllow:      ".*",
+			},
+			issuer: "https://keycloak.example.com/auth/realms/tenant-1",
+			want:   "tenant-1",
+		},
+		{
+			name: "other host",
+			provider: &KeyCloak{
+				BaseURL:    "https://keycloak/auth",
+				RealmAllow: ".*",
+			},
+			issuer:  "https://evil.example.com/auth/realms/tenant-1",
+			wantErr: true,
+		},
+		{
+			name: "sub path",
+			provider: &KeyCloak{
+				BaseURL:    "https://keycloak/auth",
+				RealmAllow: ".*",
+			},
+			issuer:  "https://keycloak/auth/realms/tenant-1/other",
+			wantErr: true,
+		},
+		{
+			name: "not allowed",
+			provider: &KeyCloak{
+				BaseURL:    "https://keycloak/auth",
+				RealmAllow: "^tenant-[0-9]+$",
+			},
+			issuer:  "https://keycloak/auth/realms/master",
+			wantErr: true,
+		},
+		{
+			name: "allowed",
+			provider: &KeyCloak{
+				BaseURL:    "https://keycloak/auth",
+				RealmAllow: "^tenant-[0-9]+$",
+			},
+			issuer: "https://keycloak/auth/realms/tenant-42",
+			want:   "tenant-42",
+		},
+		{
+			name: "partial match",
+			provider: &KeyCloak{
+				BaseURL:    "https://keycloak/auth",
+				RealmAllow: "tenant-[0-9]+",
+			},
+			issuer:  "https://keycloak/auth/realms/my-tenant-42-x",
+			wantErr: true,
+		},
+		{
+			name: "empty allow",
+			provider: &KeyCloak{
+				BaseURL: "https://keycloak/auth",
+			},
+			issuer:  "https://keycloak/auth/realms/tenant-1",
+			wantErr: true,
+		},
+		{
+			name: "dot dot",
+			provider: &KeyCloak{
+				BaseURL:    "https://keycloak/auth",
+				RealmAllow: ".*",
+			},
+			issuer:  "https://keycloak/auth/realms/..",
+			wantErr: true,
+		},
+		{
+			name: "invalid characters",
+			provider: &KeyCloak{
+				BaseURL:    "https://keycloak/auth",
+				RealmAllow: ".*",
+			},
+			issuer:  "https://keycloak/auth/realms/tenant%2F..%2Fmaster",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.provider.GetRealmFromIssuer(tt.issuer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("KeyCloak.GetRealmFromIssuer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("KeyCloak.GetRealmFromIssuer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyCloak_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *KeyCloak
+		uses     []Use
+		wantErrs int
+	}{
+		{
+			name: "resource server with realm",
+			provider: &KeyCloak{
+				BaseURL: "https://keycloak/auth",
+				Realm:   "test",
+			},
+			uses: []Use{UseResourceServer},
+		},
+		{
+			name: "client credentials missing",
+			provider: &KeyCloak{
+				BaseURL: "https://keycloak/auth",
+			},
+			uses:     []Use{UseResourceServer, UseClientCredentials},
+			wantErrs: 4,
+		},
+		{
+			name: "invalid urls",
+			provider: &KeyCloak{
+				BaseURL:  "keycloak/auth",
+				TokenURL: "ftp://keycloak/token",
+				Realm:    "test",
+			},
+			wantErrs: 2,
+		},
+		{
+			name: "redirect public client",
+			provider: &KeyCloak{
+				BaseURL:  "https://keycloak/auth",
+				Realm:    "test",
+				ClientID: "test",
+			},
+			uses: []Use{UseRedirect},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.provider.Validate(tt.uses...)
+			if tt.wantErrs == 0 {
+				if err != nil {
+					t.Fatalf("KeyCloak.Validate() error = %v", err)
+				}
+
+				return
+			}
+
+			errs, ok := err.(models.Errors)
+			if !ok {
+				t.Fatalf("KeyCloak.Validate() error = %v, want models.Errors", err)
+			}
+
+			if len(errs) != tt.wantErrs {
+				t.Errorf("KeyCloak.Validate() errors = %v, want %d errors", errs, tt.wantErrs)
+			}
 		})
 	}
 }
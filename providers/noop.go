@@ -0,0 +1,48 @@
+package providers
+
+import "strings"
+
+// Noop is the configuration of the noop provider for local development.
+//
+// Identity is used as claims when no token is sent.
+type Noop struct {
+	// Subject is the "sub" claim.
+	Subject string `cfg:"subject"`
+	// Username is the "preferred_username" claim.
+	Username string `cfg:"username"`
+	// Roles set to "realm_access.roles" claim.
+	Roles []string `cfg:"roles"`
+	// Scopes set to "scope" claim as space separated.
+	Scopes []string `cfg:"scopes"`
+	// Custom claims, overrides the other claims with the same key.
+	Custom map[string]interface{} `cfg:"custom"`
+}
+
+// MapClaims returns the identity as map claims.
+func (p *Noop) MapClaims() map[string]interface{} {
+	v := make(map[string]interface{}, len(p.Custom)+4)
+
+	if p.Subject != "" {
+		v["sub"] = p.Subject
+	}
+
+	if p.Username != "" {
+		v["preferred_username"] = p.Username
+	}
+
+	if len(p.Roles) > 0 {
+		v["realm_access"] = map[string]interface{}{
+			"roles": p.Roles,
+		}
+	}
+
+	if len(p.Scopes) > 0 {
+		v["scope"] = strings.Join(p.Scopes, " ")
+	}
+
+	for k, c := range p.Custom {
+		v[k] = c
+	}
+
+	return v
+}
@@ -0,0 +1,54 @@
+package providers
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Use is the intended use of the provider to validate the required fields.
+type Use string
+
+const (
+	// UseResourceServer requires the cert URL to verify tokens.
+	UseResourceServer Use = "resource_server"
+	// UseIntrospect requires the introspect URL and client ID to verify tokens.
+	UseIntrospect Use = "introspect"
+	// UseClientCredentials requires the token URL, client ID and client secret to get tokens.
+	UseClientCredentials Use = "client_credentials"
+	// UseRedirect requires the auth URL, token URL and client ID for redirection flow.
+	UseRedirect Use = "redirect"
+)
+
+// validateURL checks the URL has http or https scheme and host, empty value is valid.
+func validateURL(name, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("%s is invalid: %w", name, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s is invalid: scheme must be http or https", name)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("%s is invalid: host is required", name)
+	}
+
+	return nil
+}
+
+// validateURLs checks the list of name, value pairs.
+func validateURLs(nameValues ...string) []error {
+	var errs []error
+	for i := 0; i+1 < len(nameValues); i += 2 {
+		if err := validateURL(nameValues[i], nameValues[i+1]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"github.com/worldline-go/auth/redirect"
+)
+
+// SetRedirect fills the empty endpoints, client and scopes of the redirect setting with the provider's values.
+//
+// Calls to the provider use the provider's client policy when the setting has no Client and DPoP proofs if enabled.
+func (p *ProviderExtra) SetRedirect(setting *redirect.Setting) {
+	setIfEmpty(&setting.AuthURL, p.GetAuthURLExternal())
+	setIfEmpty(&setting.TokenURL, p.GetTokenURL())
+	setIfEmpty(&setting.LogoutURL, p.GetLogoutURLExternal())
+	setIfEmpty(&setting.RevocationURL, p.GetRevocationURL())
+	setIfEmpty(&setting.PARURL, p.GetPARURL())
+
+	if setting.ClientID == "" {
+		setting.ClientID = p.GetClientID()
+		setting.ClientSecret = p.GetClientSecret()
+	}
+
+	if setting.Scopes == nil {
+		setting.Scopes = p.GetScopes()
+	}
+
+	if setting.Client == nil {
+		setting.Client = p.client
+	}
+
+	if setting.DPoP == nil {
+		setting.DPoP = p.dpop
+	}
+}
+
+func setIfEmpty(v *string, value string) {
+	if *v == "" {
+		*v = value
+	}
+}
@@ -4,13 +4,18 @@ import (
 	"net/http"
 	"regexp"
 
+	"github.com/worldline-go/auth/request"
 	"github.com/worldline-go/auth/store"
 )
 
 type Setting struct {
-	AuthURL      string   `cfg:"-"`
-	TokenURL     string   `cfg:"-"`
-	LogoutURL    string   `cfg:"-"`
+	AuthURL   string `cfg:"-"`
+	TokenURL  string `cfg:"-"`
+	LogoutURL string `cfg:"-"`
+	// RevocationURL is required for Logout.Revoke.
+	RevocationURL string `cfg:"-"`
+	// PARURL is required for UsePAR.
+	PARURL       string   `cfg:"-"`
 	ClientID     string   `cfg:"-"`
 	ClientSecret string   `cfg:"-"`
 	Scopes       []string `cfg:"-"`
@@ -57,6 +62,12 @@ type Setting struct {
 	// Use Store.GetSessionFilesystem to get the store.
 	SessionStoreName string `cfg:"session_store_name"`
 
+	// DisablePKCE for not sending S256 code challenge in the authorization request.
+	DisablePKCE bool `cfg:"disable_pkce"`
+	// UsePAR pushes the authorization request parameters to the PARURL with the client authentication, RFC 9126.
+	// Browser is redirected with only client_id and request_uri.
+	UsePAR bool `cfg:"use_par"`
+
 	// TokenHeader to add token to header.
 	TokenHeader bool `cfg:"token_header"`
 	// RefreshToken is use to refresh the token.
@@ -73,6 +84,8 @@ type Setting struct {
 	Logout Logout `cfg:"logout"`
 
 	Client *http.Client `cfg:"-"`
+	// DPoP adds proofs to the token, revocation and pushed authorization requests, optional.
+	DPoP *request.DPoP `cfg:"-"`
 }
 
 type Logout struct {
@@ -80,6 +93,8 @@ type Logout struct {
 	Path string `cfg:"url"`
 	// Redirect is the redirect URL after logout.
 	Redirect string `cfg:"redirect"`
+	// Revoke the stored refresh token before clearing the cookie, RevocationURL is required.
+	Revoke bool `cfg:"revoke"`
 }
 
 type Information struct {
@@ -0,0 +1,38 @@
+package redirect
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/worldline-go/auth/request"
+)
+
+// PushAuthorization pushes the authorization request parameters to the PARURL.
+//
+// Returns the authorization URL with only the client_id and request_uri.
+func PushAuthorization(ctx context.Context, params url.Values, redirect *Setting) (string, error) {
+	if redirect.PARURL == "" {
+		return "", fmt.Errorf("par url is empty")
+	}
+
+	authClient := request.Auth{
+		Client: redirect.Client,
+		DPoP:   redirect.DPoP,
+	}
+
+	response, err := authClient.PushedAuthorization(ctx, request.PushedAuthorizationConfig{
+		PARURL: redirect.PARURL,
+		Params: params,
+		AuthRequestConfig: request.AuthRequestConfig{
+			ClientID:     redirect.ClientID,
+			ClientSecret: redirect.ClientSecret,
+			TokenURL:     redirect.TokenURL,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed pushed authorization request: %w", err)
+	}
+
+	return request.PushedAuthorizationURL(redirect.AuthURL, redirect.ClientID, response.RequestURI), nil
+}
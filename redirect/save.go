@@ -15,6 +15,17 @@ type RedirectValue struct {
 	Path  string `json:"path,omitempty"`
 	Query string `json:"query,omitempty"`
 	State string `json:"state,omitempty"`
+	// CodeVerifier is the PKCE code verifier, empty if PKCE disabled.
+	CodeVerifier string `json:"code_verifier,omitempty"`
+}
+
+// CodeChallenge returns the S256 code challenge of the CodeVerifier.
+func (t *RedirectValue) CodeChallenge() string {
+	if t.CodeVerifier == "" {
+		return ""
+	}
+
+	return store.CodeChallengeS256(t.CodeVerifier)
 }
 
 func (t *RedirectValue) Marshal() ([]byte, error) {
@@ -45,6 +56,14 @@ func SaveRedirect(r *http.Request, w http.ResponseWriter, cookieName string, red
 		return value, fmt.Errorf("error generate state, %w", err)
 	}
 
+	// pkce
+	if !redirect.DisablePKCE {
+		value.CodeVerifier, err = store.NewCodeVerifier()
+		if err != nil {
+			return value, fmt.Errorf("error generate code verifier, %w", err)
+		}
+	}
+
 	valueMarshal, err := value.Marshal()
 	if err != nil {
 		return value, fmt.Errorf("error marshal value, %w", err)
@@ -2,6 +2,7 @@ package redirect
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/gorilla/sessions"
@@ -14,6 +15,7 @@ import (
 func RefreshToken(ctx context.Context, r *http.Request, w http.ResponseWriter, refreshToken, cookieName string, oldCookieValue string, redirect *Setting, sessionStore *sessions.FilesystemStore) (*store.Token, error) {
 	authClient := request.Auth{
 		Client: redirect.Client,
+		DPoP:   redirect.DPoP,
 	}
 
 	body, err := authClient.RefreshToken(ctx, request.RefreshTokenConfig{
@@ -55,10 +57,41 @@ func RefreshToken(ctx context.Context, r *http.Request, w http.ResponseWriter, r
 	return cookieParsed, nil
 }
 
+// RevokeToken revokes the refresh token of the stored token.
+func RevokeToken(ctx context.Context, refreshToken string, redirect *Setting) error {
+	if redirect.RevocationURL == "" {
+		return fmt.Errorf("revocation url is empty")
+	}
+
+	authClient := request.Auth{
+		Client: redirect.Client,
+		DPoP:   redirect.DPoP,
+	}
+
+	return authClient.Revoke(ctx, request.RevokeConfig{
+		RevocationURL: redirect.RevocationURL,
+		Token:         refreshToken,
+		TokenTypeHint: request.TokenTypeHintRefreshToken,
+		AuthRequestConfig: request.AuthRequestConfig{
+			ClientID:     redirect.ClientID,
+			ClientSecret: redirect.ClientSecret,
+			TokenURL:     redirect.TokenURL,
+		},
+	})
+}
+
 // CodeToken get token and set the cookie/session.
-func CodeToken(ctx context.Context, r *http.Request, w http.ResponseWriter, code, cookieName string, redirect *Setting, sessionStore *sessions.FilesystemStore) error {
+//
+// Use WithCodeVerifier to send the PKCE code verifier of the RedirectValue.
+func CodeToken(ctx context.Context, r *http.Request, w http.ResponseWriter, code, cookieName string, redirect *Setting, sessionStore *sessions.FilesystemStore, opts ...OptionCodeToken) error {
+	var o optionsCodeToken
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	authClient := request.Auth{
 		Client: redirect.Client,
+		DPoP:   redirect.DPoP,
 	}
 
 	redirectURI, err := URI(r.Clone(ctx), redirect.Callback, redirect.BaseURL, redirect.Schema, redirect.DisableRawQueryEmpty)
@@ -67,8 +100,9 @@ func CodeToken(ctx context.Context, r *http.Request, w http.ResponseWriter, code
 	}
 
 	body, err := authClient.AuthorizationCode(ctx, request.AuthorizationCodeConfig{
-		Code:        code,
-		RedirectURL: redirectURI,
+		Code:         code,
+		RedirectURL:  redirectURI,
+		CodeVerifier: o.codeVerifier,
 		AuthRequestConfig: request.AuthRequestConfig{
 			ClientID:     redirect.ClientID,
 			ClientSecret: redirect.ClientSecret,
@@ -104,3 +138,16 @@ func CodeToken(ctx context.Context, r *http.Request, w http.ResponseWriter, code
 
 	return nil
 }
+
+type optionsCodeToken struct {
+	codeVerifier string
+}
+
+type OptionCodeToken func(*optionsCodeToken)
+
+// WithCodeVerifier sets the PKCE code verifier, RedirectValue.CodeVerifier.
+func WithCodeVerifier(codeVerifier string) OptionCodeToken {
+	return func(o *optionsCodeToken) {
+		o.codeVerifier = codeVerifier
+	}
+}
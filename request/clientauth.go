@@ -0,0 +1,275 @@
+package request
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Client authentication methods of the token endpoint.
+const (
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+	AuthMethodPrivateKeyJWT     = "private_key_jwt"
+	AuthMethodTLSClientAuth     = "tls_client_auth"
+)
+
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// DefaultClientAssertionExpire is the lifetime of the generated client assertions.
+var DefaultClientAssertionExpire = time.Minute
+
+// ClientAssertionFunc returns a signed JWT to authenticate the client, audience is the token URL.
+type ClientAssertionFunc func(clientID, audience string) (string, error)
+
+// NewClientAssertion returns a ClientAssertionFunc signing with the given private key.
+//
+// Claims are iss and sub as client id, aud as audience, short exp and random jti.
+func NewClientAssertion(method jwt.SigningMethod, key interface{}, kid string) ClientAssertionFunc {
+	return func(clientID, audience string) (string, error) {
+		jti, err := randomHex(16)
+		if err != nil {
+			return "", err
+		}
+
+		now := time.Now()
+		token := jwt.NewWithClaims(method, jwt.RegisteredClaims{
+			Issuer:    clientID,
+			Subject:   clientID,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(DefaultClientAssertionExpire)),
+			ID:        jti,
+		})
+
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+
+		v, err := token.SignedString(key)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign client assertion: %w", err)
+		}
+
+		return v, nil
+	}
+}
+
+// SetClientAssertion adds the client_assertion parameters to the values.
+func SetClientAssertion(uValues url.Values, clientID, audience string, fn ClientAssertionFunc) error {
+	assertion, err := fn(clientID, audience)
+	if err != nil {
+		return err
+	}
+
+	if clientID != "" {
+		uValues.Set("client_id", clientID)
+	}
+
+	uValues.Set("client_assertion_type", ClientAssertionTypeJWTBearer)
+	uValues.Set("client_assertion", assertion)
+
+	return nil
+}
+
+// ClientAuth holds the client authentication of the token endpoint requests.
+type ClientAuth struct {
+	// Method is one of client_secret_basic, client_secret_post, private_key_jwt and tls_client_auth.
+	//
+	// Default is client_secret_basic.
+	Method       string
+	ClientID     string
+	ClientSecret string
+	// TokenURL is used as audience of the client assertion.
+	TokenURL string
+	// ClientAssertion is required for private_key_jwt.
+	ClientAssertion ClientAssertionFunc
+	// Certificate is required for tls_client_auth.
+	Certificate *tls.Certificate
+}
+
+// AuthHeaderStyle returns the style to use in AuthRequestConfig.
+func (c *ClientAuth) AuthHeaderStyle() AuthHeaderStyle {
+	switch c.Method {
+	case AuthMethodClientSecretPost, AuthMethodTLSClientAuth, AuthMethodPrivateKeyJWT:
+		return AuthHeaderStyleBody
+	default:
+		return AuthHeaderStyleBasic
+	}
+}
+
+// AuthRequestConfig returns the config to use in request flows with the given URL.
+func (c *ClientAuth) AuthRequestConfig(tokenURL string) AuthRequestConfig {
+	cfg := AuthRequestConfig{
+		TokenURL:        tokenURL,
+		ClientID:        c.ClientID,
+		AuthHeaderStyle: c.AuthHeaderStyle(),
+	}
+
+	switch c.Method {
+	case AuthMethodPrivateKeyJWT:
+		cfg.ClientAssertion = c.ClientAssertion
+		cfg.ClientAssertionAudience = c.TokenURL
+	case AuthMethodTLSClientAuth:
+	default:
+		cfg.ClientSecret = c.ClientSecret
+	}
+
+	return cfg
+}
+
+// Transport wraps the transport for the client authentication.
+//
+// For tls_client_auth, base must be nil, *http.Transport or *PolicyTransport to set the certificate.
+// For private_key_jwt, form requests get the client assertion.
+func (c *ClientAuth) Transport(base http.RoundTripper) (http.RoundTripper, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	switch c.Method {
+	case AuthMethodTLSClientAuth:
+		if c.Certificate == nil {
+			return nil, fmt.Errorf("certificate is required for %s", c.Method)
+		}
+
+		// keep the policy, set the certificate to the inner transport
+		if policy, ok := base.(*PolicyTransport); ok {
+			inner, err := c.Transport(policy.Base)
+			if err != nil {
+				return nil, err
+			}
+
+			return policy.WithBase(inner), nil
+		}
+
+		t, ok := base.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("transport must be *http.Transport for %s", c.Method)
+		}
+
+		t = t.Clone()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+
+		t.TLSClientConfig.Certificates = []tls.Certificate{*c.Certificate}
+
+		return t, nil
+	case AuthMethodPrivateKeyJWT:
+		if c.ClientAssertion == nil {
+			return nil, fmt.Errorf("client assertion is required for %s", c.Method)
+		}
+
+		return &ClientAssertionTransport{
+			Base:            base,
+			ClientID:        c.ClientID,
+			Audience:        c.TokenURL,
+			ClientAssertion: c.ClientAssertion,
+		}, nil
+	default:
+		return base, nil
+	}
+}
+
+// HTTPClient returns a client with the Transport, returns the base client if there is nothing to set.
+func (c *ClientAuth) HTTPClient(base *http.Client) (*http.Client, error) {
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	if c.Method != AuthMethodTLSClientAuth && c.Method != AuthMethodPrivateKeyJWT {
+		return base, nil
+	}
+
+	transport, err := c.Transport(base.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	client := *base
+	client.Transport = transport
+
+	return &client, nil
+}
+
+// ClientAssertionTransport adds the client assertion to the form body of the requests.
+//
+// Useful for libraries not supporting private_key_jwt like golang.org/x/oauth2.
+type ClientAssertionTransport struct {
+	Base            http.RoundTripper
+	ClientID        string
+	ClientAssertion ClientAssertionFunc
+	// Audience of the assertion, default is the request URL.
+	Audience string
+}
+
+func (t *ClientAssertionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if req.Method != http.MethodPost || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	uValues, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	audience := t.Audience
+	if audience == "" {
+		u := *req.URL
+		u.RawQuery = ""
+		audience = u.String()
+	}
+
+	if err := SetClientAssertion(uValues, t.ClientID, audience, t.ClientAssertion); err != nil {
+		return nil, err
+	}
+
+	// not send secret with the assertion
+	uValues.Del("client_secret")
+
+	encoded := []byte(uValues.Encode())
+
+	req = req.Clone(req.Context())
+	req.Header.Del("Authorization")
+	req.Body = io.NopCloser(bytes.NewReader(encoded))
+	req.ContentLength = int64(len(encoded))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(encoded)), nil
+	}
+
+	return base.RoundTrip(req)
+}
+
+func randomHex(n int) (string, error) {
+	v := make([]byte, n)
+	if _, err := rand.Read(v); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(v), nil
+}
@@ -8,6 +8,8 @@ import (
 type AuthorizationCodeConfig struct {
 	Code        string
 	RedirectURL string
+	// CodeVerifier is the PKCE code verifier of the authorization request, optional.
+	CodeVerifier string
 
 	// EndpointParams specifies additional parameters for requests to the token endpoint.
 	EndpointParams url.Values
@@ -27,6 +29,9 @@ func (a *Auth) AuthorizationCode(ctx context.Context, cfg AuthorizationCodeConfi
 	if cfg.RedirectURL != "" {
 		uValues.Set("redirect_uri", cfg.RedirectURL)
 	}
+	if cfg.CodeVerifier != "" {
+		uValues.Set("code_verifier", cfg.CodeVerifier)
+	}
 
 	for k, p := range cfg.EndpointParams {
 		uValues[k] = p
@@ -0,0 +1,178 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DefaultDeviceInterval is the polling interval if the server doesn't return one.
+var DefaultDeviceInterval = 5 * time.Second
+
+var (
+	// ErrDeviceAccessDenied is returned when the user denied the authorization request.
+	ErrDeviceAccessDenied = errors.New("device authorization denied")
+	// ErrDeviceExpired is returned when the device code expired before the user authorization.
+	ErrDeviceExpired = errors.New("device code expired")
+)
+
+type DeviceAuthorizationConfig struct {
+	// DeviceAuthURL is the device authorization endpoint.
+	DeviceAuthURL string
+
+	// EndpointParams specifies additional parameters for requests to the device authorization endpoint.
+	EndpointParams url.Values
+
+	AuthRequestConfig
+}
+
+// DeviceAuthorizationResponse is the response of the device authorization endpoint.
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	// ExpiresIn is the lifetime in seconds of the device and user codes.
+	ExpiresIn int `json:"expires_in"`
+	// Interval is the minimum seconds to wait between polling requests.
+	Interval int `json:"interval,omitempty"`
+}
+
+type DeviceTokenConfig struct {
+	// DeviceCode from the device authorization response.
+	DeviceCode string
+	// Interval between polling requests, default is DefaultDeviceInterval.
+	Interval time.Duration
+	// ExpiresIn stops the polling with ErrDeviceExpired, optional.
+	ExpiresIn time.Duration
+
+	AuthRequestConfig
+}
+
+// DeviceAuthorization starts the device authorization grant, RFC 8628.
+//
+// Show the user code and verification URI to the user and use the response in DeviceToken.
+func (a *Auth) DeviceAuthorization(ctx context.Context, cfg DeviceAuthorizationConfig) (*DeviceAuthorizationResponse, error) {
+	uValues := url.Values{}
+	if len(cfg.Scopes) > 0 {
+		uValues.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	for k, p := range cfg.EndpointParams {
+		uValues[k] = p
+	}
+
+	body, err := a.AuthRequest(ctx, uValues, cfg.AuthRequestConfig.endpoint(cfg.DeviceAuthURL))
+	if err != nil {
+		return nil, err
+	}
+
+	var response DeviceAuthorizationResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device authorization response: %w", err)
+	}
+
+	return &response, nil
+}
+
+// DeviceToken polls the token endpoint until the user authorizes the device.
+//
+// Returns ErrDeviceAccessDenied or ErrDeviceExpired if the user doesn't authorize.
+// Returns a byte array of the response body, if the response status code is 2xx.
+func (a *Auth) DeviceToken(ctx context.Context, cfg DeviceTokenConfig) ([]byte, error) {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = DefaultDeviceInterval
+	}
+
+	if cfg.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ExpiresIn)
+		defer cancel()
+	}
+
+	requestConfig := cfg.AuthRequestConfig.endpoint(cfg.TokenURL)
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, deviceContextErr(ctx, cfg)
+		case <-timer.C:
+		}
+
+		uValues := url.Values{
+			"grant_type":  {GrantTypeDeviceCode},
+			"device_code": {cfg.DeviceCode},
+		}
+
+		req, err := newAuthRequest(ctx, uValues, requestConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		_, body, err := rawRequestStatus(req, a.client())
+		if err == nil {
+			return body, nil
+		}
+
+		var oauthErr *OAuthError
+		if !errors.As(err, &oauthErr) {
+			// expiration during the request
+			if ctx.Err() != nil {
+				return nil, deviceContextErr(ctx, cfg)
+			}
+
+			return nil, err
+		}
+
+		switch oauthErr.ErrorCode {
+		case ErrorCodeAuthorizationPending:
+		case ErrorCodeSlowDown:
+			interval += 5 * time.Second
+		case ErrorCodeAccessDenied:
+			return nil, ErrDeviceAccessDenied
+		case ErrorCodeExpiredToken:
+			return nil, ErrDeviceExpired
+		default:
+			return nil, err
+		}
+
+		timer.Reset(interval)
+	}
+}
+
+// deviceContextErr returns ErrDeviceExpired if the ExpiresIn deadline is exceeded, otherwise the context error.
+func deviceContextErr(ctx context.Context, cfg DeviceTokenConfig) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && cfg.ExpiresIn > 0 {
+		return ErrDeviceExpired
+	}
+
+	return ctx.Err()
+}
+
+// IntervalDuration returns the polling interval of the response, default is DefaultDeviceInterval.
+func (r *DeviceAuthorizationResponse) IntervalDuration() time.Duration {
+	if r.Interval <= 0 {
+		return DefaultDeviceInterval
+	}
+
+	return time.Duration(r.Interval) * time.Second
+}
+
+// DeviceTokenConfig returns the polling config of the response.
+func (r *DeviceAuthorizationResponse) DeviceTokenConfig(cfg AuthRequestConfig) DeviceTokenConfig {
+	return DeviceTokenConfig{
+		DeviceCode:        r.DeviceCode,
+		Interval:          r.IntervalDuration(),
+		ExpiresIn:         time.Duration(r.ExpiresIn) * time.Second,
+		AuthRequestConfig: cfg,
+	}
+}
@@ -0,0 +1,65 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuth_DeviceToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr error
+	}{
+		{
+			name: "expired while polling",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"authorization_pending"}`))
+			},
+			wantErr: ErrDeviceExpired,
+		},
+		{
+			name: "expired during the request",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// body is read to get the context canceled by the client
+				_ = r.ParseForm()
+				<-r.Context().Done()
+			},
+			wantErr: ErrDeviceExpired,
+		},
+		{
+			name: "access denied",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"access_denied"}`))
+			},
+			wantErr: ErrDeviceAccessDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			_, err := DefaultAuth.DeviceToken(context.Background(), DeviceTokenConfig{
+				DeviceCode: "device-code",
+				Interval:   10 * time.Millisecond,
+				ExpiresIn:  100 * time.Millisecond,
+				AuthRequestConfig: AuthRequestConfig{
+					TokenURL: server.URL,
+					ClientID: "test",
+				},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeviceToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,428 @@
+package request
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DPoP headers and values, RFC 9449.
+const (
+	HeaderDPoP      = "DPoP"
+	HeaderDPoPNonce = "DPoP-Nonce"
+	// TokenTypeDPoP is the token_type of the DPoP bound tokens and the Authorization scheme.
+	TokenTypeDPoP = "DPoP"
+	// DPoPProofType is the typ header of the proof.
+	DPoPProofType = "dpop+jwt"
+
+	ErrorCodeUseDPoPNonce     = "use_dpop_nonce"
+	ErrorCodeInvalidDPoPProof = "invalid_dpop_proof"
+)
+
+// DPoPConfig is the key configuration of the DPoP proofs of a client.
+type DPoPConfig struct {
+	// Key is the PEM encoded EC private key, default is a generated P-256 key.
+	Key string `cfg:"key" log:"false"`
+
+	once sync.Once
+	dpop *DPoP
+	err  error
+}
+
+// DPoP returns the shared DPoP of the config, nil config returns nil.
+func (c *DPoPConfig) DPoP() (*DPoP, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	c.once.Do(func() {
+		var key *ecdsa.PrivateKey
+		if c.Key != "" {
+			key, c.err = parseECPrivateKey(c.Key)
+			if c.err != nil {
+				return
+			}
+		}
+
+		c.dpop, c.err = NewDPoP(key)
+	})
+
+	return c.dpop, c.err
+}
+
+// DPoP generates proofs of possession with a per-client key.
+//
+// Nonces sent by the servers are kept per origin and used in the next proofs.
+type DPoP struct {
+	key        *ecdsa.PrivateKey
+	method     jwt.SigningMethod
+	jwk        map[string]interface{}
+	thumbprint string
+
+	mutex  sync.RWMutex
+	nonces map[string]string
+}
+
+// NewDPoP returns a DPoP with the ECDSA key, nil key generates a new P-256 key.
+func NewDPoP(key *ecdsa.PrivateKey) (*DPoP, error) {
+	if key == nil {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate dpop key: %w", err)
+		}
+	}
+
+	var method jwt.SigningMethod
+	switch key.Curve {
+	case elliptic.P256():
+		method = jwt.SigningMethodES256
+	case elliptic.P384():
+		method = jwt.SigningMethodES384
+	case elliptic.P521():
+		method = jwt.SigningMethodES512
+	default:
+		return nil, fmt.Errorf("unsupported dpop key curve %s", key.Curve.Params().Name)
+	}
+
+	size := (key.Curve.Params().BitSize + 7) / 8
+	jwk := map[string]interface{}{
+		"kty": "EC",
+		"crv": key.Curve.Params().Name,
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+	}
+
+	thumbprint, err := JWKThumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DPoP{
+		key:        key,
+		method:     method,
+		jwk:        jwk,
+		thumbprint: thumbprint,
+		nonces:     make(map[string]string),
+	}, nil
+}
+
+// Thumbprint returns the JWK thumbprint of the public key, same as cnf.jkt of the bound tokens.
+func (d *DPoP) Thumbprint() string {
+	return d.thumbprint
+}
+
+// Proof returns a signed proof for the request, accessToken is optional to bind the proof to the token with ath.
+func (d *DPoP) Proof(method, rawURL, accessToken string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse dpop url: %w", err)
+	}
+
+	return d.proof(method, u, accessToken)
+}
+
+func (d *DPoP) proof(method string, u *url.URL, accessToken string) (string, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"jti": jti,
+		"htm": method,
+		"htu": DPoPHTU(u),
+		"iat": time.Now().Unix(),
+	}
+
+	if accessToken != "" {
+		claims["ath"] = AccessTokenHash(accessToken)
+	}
+
+	if nonce := d.Nonce(u.String()); nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	token := jwt.NewWithClaims(d.method, claims)
+	token.Header["typ"] = DPoPProofType
+	token.Header["jwk"] = d.jwk
+
+	v, err := token.SignedString(d.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign dpop proof: %w", err)
+	}
+
+	return v, nil
+}
+
+// Nonce returns the last nonce of the url's origin.
+func (d *DPoP) Nonce(rawURL string) string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.nonces[origin(rawURL)]
+}
+
+// SetNonce sets the nonce of the url's origin for the next proofs.
+func (d *DPoP) SetNonce(rawURL, nonce string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.nonces[origin(rawURL)] = nonce
+}
+
+// Client returns a copy of the client adding proofs to the requests, nil base uses http.DefaultClient.
+func (d *DPoP) Client(base *http.Client) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	client := *base
+	client.Transport = d.Transport(base.Transport)
+
+	return &client
+}
+
+// Transport returns a RoundTripper adding proofs to the requests.
+func (d *DPoP) Transport(base http.RoundTripper) http.RoundTripper {
+	return &DPoPTransport{
+		Base: base,
+		DPoP: d,
+	}
+}
+
+// DPoPTransport adds the DPoP header to the requests.
+//
+// Authorization header with DPoP scheme binds the proof to the access token.
+// Requests are retried once if the server asks to use a new nonce.
+type DPoPTransport struct {
+	Base http.RoundTripper
+	DPoP *DPoP
+}
+
+func (t *DPoPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var accessToken string
+	if v := req.Header.Get("Authorization"); len(v) > len(TokenTypeDPoP)+1 && strings.EqualFold(v[:len(TokenTypeDPoP)+1], TokenTypeDPoP+" ") {
+		accessToken = v[len(TokenTypeDPoP)+1:]
+	}
+
+	for retry := true; ; retry = false {
+		nonce := t.DPoP.Nonce(req.URL.String())
+
+		proof, err := t.DPoP.proof(req.Method, req.URL, accessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		reqProof := req.Clone(req.Context())
+		reqProof.Header.Set(HeaderDPoP, proof)
+
+		resp, err := base.RoundTrip(reqProof)
+		if err != nil {
+			return nil, err
+		}
+
+		newNonce := resp.Header.Get(HeaderDPoPNonce)
+		if newNonce == "" || newNonce == nonce {
+			return resp, nil
+		}
+
+		t.DPoP.SetNonce(req.URL.String(), newNonce)
+
+		// https://datatracker.ietf.org/doc/html/rfc9449#section-8
+		if !retry || (resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnauthorized) {
+			return resp, nil
+		}
+
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+	}
+}
+
+// DPoPHTU returns the htu value of the url without query and fragment.
+func DPoPHTU(u *url.URL) string {
+	v := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   u.Path,
+	}
+
+	return v.String()
+}
+
+// AccessTokenHash returns the ath value of the access token.
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKThumbprint returns the SHA-256 JWK thumbprint of the public key, RFC 7638.
+func JWKThumbprint(jwk map[string]interface{}) (string, error) {
+	var members []string
+	switch jwk["kty"] {
+	case "EC":
+		members = []string{"crv", "kty", "x", "y"}
+	case "RSA":
+		members = []string{"e", "kty", "n"}
+	case "OKP":
+		members = []string{"crv", "kty", "x"}
+	default:
+		return "", fmt.Errorf("unsupported jwk kty %v", jwk["kty"])
+	}
+
+	// members are in lexicographic order and json.Marshal sorts map keys
+	required := make(map[string]string, len(members))
+	for _, m := range members {
+		v, ok := jwk[m].(string)
+		if !ok || v == "" {
+			return "", fmt.Errorf("jwk member %s is missing", m)
+		}
+
+		required[m] = v
+	}
+
+	b, err := json.Marshal(required)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// PublicKeyFromJWK returns the EC or RSA public key of the JWK, private keys are rejected.
+func PublicKeyFromJWK(jwk map[string]interface{}) (crypto.PublicKey, error) {
+	if _, ok := jwk["d"]; ok {
+		return nil, fmt.Errorf("jwk contains a private key")
+	}
+
+	decode := func(name string) (*big.Int, error) {
+		v, _ := jwk[name].(string)
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid jwk member %s", name)
+		}
+
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch jwk["kty"] {
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk["crv"] {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported jwk crv %v", jwk["crv"])
+		}
+
+		x, err := decode("x")
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decode("y")
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("jwk point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "RSA":
+		n, err := decode("n")
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decode("e")
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid jwk member e")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	default:
+		return nil, fmt.Errorf("unsupported jwk kty %v", jwk["kty"])
+	}
+}
+
+func parseECPrivateKey(v string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(v))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode dpop key PEM")
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dpop key: %w", err)
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("dpop key must be an EC private key")
+	}
+
+	return ecKey, nil
+}
+
+// origin returns the scheme and host of the url.
+func origin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	return u.Scheme + "://" + u.Host
+}
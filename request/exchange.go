@@ -0,0 +1,87 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeIDToken      = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT          = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+type TokenExchangeConfig struct {
+	// SubjectToken is the token to exchange, required.
+	SubjectToken string
+	// SubjectTokenType is the type of SubjectToken, default is TokenTypeAccessToken.
+	SubjectTokenType string
+	// ActorToken is the token of the acting party, optional.
+	ActorToken string
+	// ActorTokenType is the type of ActorToken, default is TokenTypeAccessToken if ActorToken is set.
+	ActorTokenType string
+	// Audience is the logical names of the target services.
+	Audience []string
+	// Resource is the URIs of the target services.
+	Resource []string
+	// RequestedTokenType is the type of the requested token, optional.
+	RequestedTokenType string
+
+	// EndpointParams specifies additional parameters for requests to the token endpoint.
+	EndpointParams url.Values
+
+	AuthRequestConfig
+}
+
+// TokenExchange is a function to handle token exchange flow, RFC 8693.
+//
+// Returns a byte array of the response body, if the response status code is 2xx.
+func (a *Auth) TokenExchange(ctx context.Context, cfg TokenExchangeConfig) ([]byte, error) {
+	if cfg.SubjectToken == "" {
+		return nil, fmt.Errorf("subject token is required")
+	}
+
+	subjectTokenType := cfg.SubjectTokenType
+	if subjectTokenType == "" {
+		subjectTokenType = TokenTypeAccessToken
+	}
+
+	uValues := url.Values{
+		"grant_type":         {GrantTypeTokenExchange},
+		"subject_token":      {cfg.SubjectToken},
+		"subject_token_type": {subjectTokenType},
+	}
+
+	if cfg.ActorToken != "" {
+		actorTokenType := cfg.ActorTokenType
+		if actorTokenType == "" {
+			actorTokenType = TokenTypeAccessToken
+		}
+
+		uValues.Set("actor_token", cfg.ActorToken)
+		uValues.Set("actor_token_type", actorTokenType)
+	}
+
+	for _, audience := range cfg.Audience {
+		uValues.Add("audience", audience)
+	}
+	for _, resource := range cfg.Resource {
+		uValues.Add("resource", resource)
+	}
+	if cfg.RequestedTokenType != "" {
+		uValues.Set("requested_token_type", cfg.RequestedTokenType)
+	}
+	if len(cfg.Scopes) > 0 {
+		uValues.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	for k, p := range cfg.EndpointParams {
+		uValues[k] = p
+	}
+
+	return a.AuthRequest(ctx, uValues, cfg.AuthRequestConfig)
+}
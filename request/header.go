@@ -12,6 +12,8 @@ const (
 	AuthHeaderStyleBasic AuthHeaderStyle = iota
 	AuthHeaderStyleBearerSecret
 	AuthHeaderStyleParams
+	// AuthHeaderStyleBody sets client_id and client_secret in the form body, client_secret_post.
+	AuthHeaderStyleBody
 )
 
 // AuthHeader is a function to set Authorization header.
@@ -51,6 +53,22 @@ func AuthParams(clientID, clientSecret string, req *http.Request, style AuthHead
 	req.URL.RawQuery = query.Encode()
 }
 
+// AuthBody is a function to set Authorization params in the form body.
+//
+// Style must be AuthHeaderStyleBody, otherwise it does nothing.
+func AuthBody(uValues url.Values, clientID, clientSecret string, style AuthHeaderStyle) {
+	if style != AuthHeaderStyleBody {
+		return
+	}
+
+	if clientID != "" {
+		uValues.Set("client_id", clientID)
+	}
+	if clientSecret != "" {
+		uValues.Set("client_secret", clientSecret)
+	}
+}
+
 // SetBearerAuth sets the Authorization header to use Bearer token.
 func SetBearerAuth(r *http.Request, token string) {
 	r.Header.Add("Authorization", "Bearer "+token)
@@ -0,0 +1,39 @@
+package request
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+const GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+type JWTBearerConfig struct {
+	// Assertion is the signed JWT to exchange, required.
+	Assertion string
+
+	// EndpointParams specifies additional parameters for requests to the token endpoint.
+	EndpointParams url.Values
+
+	AuthRequestConfig
+}
+
+// JWTBearer is a function to handle JWT bearer authorization grant, RFC 7523.
+//
+// Client authentication is optional, without ClientSecret and ClientAssertion only client_id is sent.
+// Returns a byte array of the response body, if the response status code is 2xx.
+func (a *Auth) JWTBearer(ctx context.Context, cfg JWTBearerConfig) ([]byte, error) {
+	uValues := url.Values{
+		"grant_type": {GrantTypeJWTBearer},
+		"assertion":  {cfg.Assertion},
+	}
+
+	if len(cfg.Scopes) > 0 {
+		uValues.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	for k, p := range cfg.EndpointParams {
+		uValues[k] = p
+	}
+
+	return a.AuthRequest(ctx, uValues, cfg.AuthRequestConfig.endpoint(cfg.TokenURL))
+}
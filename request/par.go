@@ -0,0 +1,61 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+type PushedAuthorizationConfig struct {
+	// PARURL is the pushed authorization request endpoint.
+	PARURL string
+	// Params are the authorization request parameters like response_type, redirect_uri and state.
+	Params url.Values
+
+	AuthRequestConfig
+}
+
+// PushedAuthorizationResponse is the response of the pushed authorization request endpoint.
+type PushedAuthorizationResponse struct {
+	// RequestURI is the reference of the pushed parameters to send to the authorization endpoint.
+	RequestURI string `json:"request_uri"`
+	// ExpiresIn is the lifetime in seconds of the request URI.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// PushedAuthorization pushes the authorization request parameters with the client authentication, RFC 9126.
+//
+// Redirect the user to the authorization endpoint with only client_id and the returned request_uri.
+func (a *Auth) PushedAuthorization(ctx context.Context, cfg PushedAuthorizationConfig) (*PushedAuthorizationResponse, error) {
+	uValues := url.Values{}
+	for k, p := range cfg.Params {
+		uValues[k] = p
+	}
+
+	uValues.Set("client_id", cfg.ClientID)
+
+	body, err := a.AuthRequest(ctx, uValues, cfg.AuthRequestConfig.endpoint(cfg.PARURL))
+	if err != nil {
+		return nil, err
+	}
+
+	var response PushedAuthorizationResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pushed authorization response: %w", err)
+	}
+
+	if response.RequestURI == "" {
+		return nil, fmt.Errorf("request_uri is empty in pushed authorization response")
+	}
+
+	return &response, nil
+}
+
+// PushedAuthorizationURL returns the authorization URL with only the client_id and request_uri.
+func PushedAuthorizationURL(authURL, clientID, requestURI string) string {
+	return authURL + "?" + url.Values{
+		"client_id":   {clientID},
+		"request_uri": {requestURI},
+	}.Encode()
+}
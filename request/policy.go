@@ -0,0 +1,430 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/worldline-go/auth/models"
+)
+
+// ErrCircuitOpen is returned without calling the server when the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Default values of the ClientPolicy.
+var (
+	DefaultPolicyTimeout          = 10 * time.Second
+	DefaultPolicyRetryMax         = 2
+	DefaultPolicyRetryWaitMin     = 100 * time.Millisecond
+	DefaultPolicyRetryWaitMax     = 2 * time.Second
+	DefaultPolicyBreakerThreshold = 5
+	DefaultPolicyBreakerTimeout   = 30 * time.Second
+)
+
+// ClientPolicy is the policy of the calls to the identity provider.
+//
+// Zero values use the defaults, negative values disable the feature.
+type ClientPolicy struct {
+	// Timeout of each attempt, default is DefaultPolicyTimeout.
+	Timeout time.Duration `cfg:"timeout"`
+	// RetryMax is the maximum retry count on network errors, 429 and 5xx, default is DefaultPolicyRetryMax.
+	//
+	// Non-idempotent requests are retried only on 429, 503 and errors before the request is written.
+	RetryMax int `cfg:"retry_max"`
+	// RetryWaitMin is the base of the jittered exponential backoff, default is DefaultPolicyRetryWaitMin.
+	RetryWaitMin time.Duration `cfg:"retry_wait_min"`
+	// RetryWaitMax is the maximum wait between attempts, default is DefaultPolicyRetryWaitMax.
+	//
+	// Longer Retry-After header values are not waited and the response is returned.
+	RetryWaitMax time.Duration `cfg:"retry_wait_max"`
+	// BreakerThreshold is the consecutive failed calls to open the circuit, default is DefaultPolicyBreakerThreshold.
+	BreakerThreshold int `cfg:"breaker_threshold"`
+	// BreakerTimeout is the duration to reject calls before trying again, default is DefaultPolicyBreakerTimeout.
+	BreakerTimeout time.Duration `cfg:"breaker_timeout"`
+
+	once   sync.Once
+	client *http.Client
+}
+
+// HTTPClient returns the shared client of the policy, nil policy returns nil.
+//
+// Circuit breaker state is shared by all users of the client.
+func (p *ClientPolicy) HTTPClient() *http.Client {
+	if p == nil {
+		return nil
+	}
+
+	p.once.Do(func() {
+		p.client = &http.Client{
+			Transport: p.Transport(nil),
+		}
+	})
+
+	return p.client
+}
+
+// Validate checks the backoff and circuit breaker values, nil policy is valid.
+func (p *ClientPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+
+	var errs models.Errors
+
+	waitMin := orDefault(p.RetryWaitMin, DefaultPolicyRetryWaitMin)
+	waitMax := orDefault(p.RetryWaitMax, DefaultPolicyRetryWaitMax)
+	if waitMin > 0 && waitMax > 0 && waitMin > waitMax {
+		errs = append(errs, fmt.Errorf("retry_wait_min %s is greater than retry_wait_max %s", waitMin, waitMax))
+	}
+
+	if orDefault(p.BreakerThreshold, DefaultPolicyBreakerThreshold) > 0 && orDefault(p.BreakerTimeout, DefaultPolicyBreakerTimeout) < 0 {
+		errs = append(errs, fmt.Errorf("breaker_timeout must be positive when the breaker is enabled"))
+	}
+
+	return errs.Err()
+}
+
+// Transport returns a new PolicyTransport with its own circuit breaker.
+func (p *ClientPolicy) Transport(base http.RoundTripper) *PolicyTransport {
+	t := &PolicyTransport{
+		Base:         base,
+		Timeout:      orDefault(p.Timeout, DefaultPolicyTimeout),
+		RetryMax:     orDefault(p.RetryMax, DefaultPolicyRetryMax),
+		RetryWaitMin: orDefault(p.RetryWaitMin, DefaultPolicyRetryWaitMin),
+		RetryWaitMax: orDefault(p.RetryWaitMax, DefaultPolicyRetryWaitMax),
+	}
+
+	if threshold := orDefault(p.BreakerThreshold, DefaultPolicyBreakerThreshold); threshold > 0 {
+		t.breaker = &breaker{
+			threshold: threshold,
+			timeout:   orDefault(p.BreakerTimeout, DefaultPolicyBreakerTimeout),
+		}
+	}
+
+	return t
+}
+
+// PolicyTransport applies timeout, retry with backoff and circuit breaker to the requests.
+type PolicyTransport struct {
+	Base         http.RoundTripper
+	Timeout      time.Duration
+	RetryMax     int
+	RetryWaitMin time.Duration
+	RetryWaitMax time.Duration
+
+	breaker *breaker
+}
+
+// WithBase returns a copy of the transport sharing the circuit breaker.
+func (t *PolicyTransport) WithBase(base http.RoundTripper) *PolicyTransport {
+	v := *t
+	v.Base = base
+
+	return &v
+}
+
+// CloseIdleConnections closes the idle connections of the base transport.
+func (t *PolicyTransport) CloseIdleConnections() {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if v, ok := base.(interface{ CloseIdleConnections() }); ok {
+		v.CloseIdleConnections()
+	}
+}
+
+func (t *PolicyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	trial, ok := t.breaker.allow()
+	if !ok {
+		return nil, ErrCircuitOpen
+	}
+
+	// body must be replayable to retry
+	retryMax := t.RetryMax
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		retryMax = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				t.breaker.done(trial, false)
+
+				return nil, err
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, written, err := t.roundTrip(base, req)
+
+		// canceled by the caller, not a failure of the server
+		if req.Context().Err() != nil {
+			t.breaker.release(trial)
+
+			return resp, err
+		}
+
+		failed := isFailure(resp, err)
+		if !failed || attempt >= retryMax || !isRetryable(req, resp, written, err) {
+			t.breaker.done(trial, !failed)
+
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		if resp != nil {
+			retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"))
+			if ok && retryAfter > t.RetryWaitMax {
+				t.breaker.done(trial, false)
+
+				return resp, nil
+			}
+
+			if retryAfter > wait {
+				wait = retryAfter
+			}
+
+			// drain to reuse the connection
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			t.breaker.release(trial)
+
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTrip sends the request with the attempt timeout, timeout is released when the body is closed.
+//
+// Written is false only when the connection is requested and the request headers are not sent,
+// transports without the trace events are counted as written.
+func (t *PolicyTransport) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, bool, error) {
+	const (
+		traceGetConn int32 = iota + 1
+		traceWroteHeaders
+	)
+
+	var state int32
+
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GetConn: func(string) {
+			atomic.CompareAndSwapInt32(&state, 0, traceGetConn)
+		},
+		WroteHeaders: func() {
+			atomic.StoreInt32(&state, traceWroteHeaders)
+		},
+	})
+
+	cancel := context.CancelFunc(func() {})
+	if t.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+	}
+
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+
+		return nil, atomic.LoadInt32(&state) != traceGetConn, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, true, nil
+}
+
+// isFailure reports a failure of the server for the circuit breaker, network errors, 429 and 5xx.
+func isFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// isRetryable reports the failed request is safe to send again.
+//
+// Non-idempotent requests, like token requests with POST, are only retried when the server did not process them:
+// 429, 503 or an error before the request is written.
+func isRetryable(req *http.Request, resp *http.Response, written bool, err error) bool {
+	if isIdempotent(req) {
+		return true
+	}
+
+	if err != nil {
+		return !written
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// isIdempotent checks the method like the http.Transport, Idempotency-Key header marks the request idempotent.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	_, ok := req.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
+	}
+
+	return ok
+}
+
+// backoff returns equal jittered exponential backoff of the attempt.
+func (t *PolicyTransport) backoff(attempt int) time.Duration {
+	if t.RetryWaitMin <= 0 {
+		return 0
+	}
+
+	wait := t.RetryWaitMin << attempt
+	if wait <= 0 || (t.RetryWaitMax > 0 && wait > t.RetryWaitMax) {
+		wait = t.RetryWaitMax
+	}
+
+	if wait <= 0 {
+		return t.RetryWaitMin
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// parseRetryAfter parses seconds or HTTP date format.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(v); err == nil {
+		return time.Until(date), true
+	}
+
+	return 0, false
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
+
+// breaker opens after consecutive failures and allows one trial call after the timeout.
+type breaker struct {
+	threshold int
+	timeout   time.Duration
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// allow reports the call can be sent, trial is true for the only call of the half open state.
+//
+// Trial must be passed to done or release, other calls don't end the trial.
+func (b *breaker) allow() (trial, ok bool) {
+	if b == nil {
+		return false, true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failures < b.threshold {
+		return false, true
+	}
+
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false, false
+	}
+
+	// half open
+	b.trial = true
+
+	return true, true
+}
+
+// release ends the trial without changing the state.
+func (b *breaker) release(trial bool) {
+	if b == nil || !trial {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) done(trial, success bool) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if trial {
+		b.trial = false
+	}
+
+	if success {
+		b.failures = 0
+
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.timeout)
+	}
+}
+
+func orDefault[T int | time.Duration](v, def T) T {
+	if v == 0 {
+		return def
+	}
+
+	if v < 0 {
+		return 0
+	}
+
+	return v
+}
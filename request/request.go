@@ -2,7 +2,6 @@ package request
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -18,6 +17,8 @@ var DefaultAuth = &Auth{
 type Auth struct {
 	// Client is a http client to use. If nil, http.DefaultClient will be used.
 	Client *http.Client
+	// DPoP adds proofs to the requests to get DPoP bound tokens, optional.
+	DPoP *DPoP
 }
 
 type AuthRequestConfig struct {
@@ -29,12 +30,57 @@ type AuthRequestConfig struct {
 	AuthHeaderStyle AuthHeaderStyle
 	// Scopes for refresh and password flow.
 	Scopes []string
+	// ClientAssertion is optional to authenticate with private_key_jwt, ClientSecret is not used with it.
+	ClientAssertion ClientAssertionFunc
+	// ClientAssertionAudience is the audience of the assertion, default is TokenURL.
+	ClientAssertionAudience string
 }
 
 func (a *Auth) AuthRequest(ctx context.Context, uValues url.Values, cfg AuthRequestConfig) ([]byte, error) {
-	encodedData := uValues.Encode()
+	req, err := newAuthRequest(ctx, uValues, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.RawRequest(req)
+}
+
+// endpoint returns the config to authenticate to another endpoint of the server.
+//
+// Token URL stays as the client assertion audience, public clients send only the client_id.
+func (cfg AuthRequestConfig) endpoint(endpointURL string) AuthRequestConfig {
+	if cfg.ClientAssertionAudience == "" {
+		cfg.ClientAssertionAudience = cfg.TokenURL
+	}
+
+	cfg.TokenURL = endpointURL
+
+	if cfg.ClientSecret == "" && cfg.ClientAssertion == nil {
+		cfg.AuthHeaderStyle = AuthHeaderStyleBody
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.TokenURL, strings.NewReader(encodedData))
+	return cfg
+}
+
+// newAuthRequest returns a form request with the client authentication.
+func newAuthRequest(ctx context.Context, uValues url.Values, cfg AuthRequestConfig) (*http.Request, error) {
+	if cfg.ClientAssertion != nil {
+		audience := cfg.ClientAssertionAudience
+		if audience == "" {
+			audience = cfg.TokenURL
+		}
+
+		if err := SetClientAssertion(uValues, cfg.ClientID, audience, cfg.ClientAssertion); err != nil {
+			return nil, err
+		}
+
+		return newFormRequest(ctx, cfg.TokenURL, uValues)
+	}
+
+	// set if style is body
+	AuthBody(uValues, cfg.ClientID, cfg.ClientSecret, cfg.AuthHeaderStyle)
+
+	req, err := newFormRequest(ctx, cfg.TokenURL, uValues)
 	if err != nil {
 		return nil, err
 	}
@@ -43,34 +89,62 @@ func (a *Auth) AuthRequest(ctx context.Context, uValues url.Values, cfg AuthRequ
 	AuthParams(cfg.ClientID, cfg.ClientSecret, req, cfg.AuthHeaderStyle)
 	AuthHeader(req, cfg.ClientID, cfg.ClientSecret, cfg.AuthHeaderStyle)
 
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("accept", "application/json")
-
-	return a.RawRequest(req)
+	return req, nil
 }
 
 func (a *Auth) RawRequest(req *http.Request) ([]byte, error) {
-	client := a.Client
-	if client == nil {
-		client = http.DefaultClient
+	return RawRequest(req, a.client())
+}
+
+func (a *Auth) client() *http.Client {
+	if a.DPoP != nil {
+		return a.DPoP.Client(a.Client)
 	}
 
-	return RawRequest(req, client)
+	if a.Client == nil {
+		return http.DefaultClient
+	}
+
+	return a.Client
 }
 
+// RawRequest returns the body of the 2xx response, otherwise *OAuthError with the status code.
 func RawRequest(req *http.Request, client *http.Client) ([]byte, error) {
+	_, body, err := rawRequestStatus(req, client)
+
+	return body, err
+}
+
+// rawRequestStatus returns the status code with the body, status code is 0 if request failed.
+func rawRequestStatus(req *http.Request, client *http.Client) (int, []byte, error) {
 	r, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
 	// 1MB limit
 	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
 	r.Body.Close()
 
+	if err != nil {
+		return r.StatusCode, nil, err
+	}
+
 	if code := r.StatusCode; code < 200 || code > 299 {
-		return nil, fmt.Errorf(string(body))
+		return code, nil, NewOAuthError(code, body)
+	}
+
+	return r.StatusCode, body, nil
+}
+
+func newFormRequest(ctx context.Context, tokenURL string, uValues url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(uValues.Encode()))
+	if err != nil {
+		return nil, err
 	}
 
-	return body, nil
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("accept", "application/json")
+
+	return req, nil
 }
@@ -0,0 +1,345 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRawRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		want       string
+		wantErr    *OAuthError
+		wantErrMsg string
+	}{
+		{
+			name:   "success",
+			status: http.StatusOK,
+			body:   `{"access_token":"token"}`,
+			want:   `{"access_token":"token"}`,
+		},
+		{
+			name:   "oauth error",
+			status: http.StatusBadRequest,
+			body:   `{"error":"invalid_grant","error_description":"token expired","error_uri":"https://example.com/error"}`,
+			wantErr: &OAuthError{
+				StatusCode:       http.StatusBadRequest,
+				ErrorCode:        ErrorCodeInvalidGrant,
+				ErrorDescription: "token expired",
+				ErrorURI:         "https://example.com/error",
+			},
+			wantErrMsg: "invalid_grant: token expired (status code 400)",
+		},
+		{
+			name:   "oauth error without description",
+			status: http.StatusUnauthorized,
+			body:   `{"error":"invalid_client"}`,
+			wantErr: &OAuthError{
+				StatusCode: http.StatusUnauthorized,
+				ErrorCode:  ErrorCodeInvalidClient,
+			},
+			wantErrMsg: "invalid_client (status code 401)",
+		},
+		{
+			name:       "not json",
+			status:     http.StatusBadGateway,
+			body:       "bad gateway",
+			wantErr:    &OAuthError{StatusCode: http.StatusBadGateway},
+			wantErrMsg: "bad gateway",
+		},
+		{
+			name:       "empty body",
+			status:     http.StatusInternalServerError,
+			wantErr:    &OAuthError{StatusCode: http.StatusInternalServerError},
+			wantErrMsg: "status code 500",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			req, err := newFormRequest(context.Background(), srv.URL, url.Values{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, err := RawRequest(req, srv.Client())
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(body) != tt.want {
+					t.Errorf("RawRequest() = %s, want %s", body, tt.want)
+				}
+
+				return
+			}
+
+			var oauthErr *OAuthError
+			if !errors.As(err, &oauthErr) {
+				t.Fatalf("RawRequest() error = %v, want *OAuthError", err)
+			}
+
+			if oauthErr.StatusCode != tt.wantErr.StatusCode ||
+				oauthErr.ErrorCode != tt.wantErr.ErrorCode ||
+				oauthErr.ErrorDescription != tt.wantErr.ErrorDescription ||
+				oauthErr.ErrorURI != tt.wantErr.ErrorURI {
+				t.Errorf("RawRequest() error = %#v, want %#v", oauthErr, tt.wantErr)
+			}
+
+			if string(oauthErr.Body) != tt.body {
+				t.Errorf("RawRequest() error body = %s, want %s", oauthErr.Body, tt.body)
+			}
+
+			if err.Error() != tt.wantErrMsg {
+				t.Errorf("RawRequest() error = %q, want %q", err.Error(), tt.wantErrMsg)
+			}
+		})
+	}
+}
+
+func TestIsErrorCode(t *testing.T) {
+	oauthErr := NewOAuthError(http.StatusBadRequest, []byte(`{"error":"invalid_grant"}`))
+
+	tests := []struct {
+		name string
+		err  error
+		code string
+		want bool
+	}{
+		{
+			name: "nil",
+			code: ErrorCodeInvalidGrant,
+		},
+		{
+			name: "not oauth error",
+			err:  errors.New("invalid_grant"),
+			code: ErrorCodeInvalidGrant,
+		},
+		{
+			name: "same code",
+			err:  oauthErr,
+			code: ErrorCodeInvalidGrant,
+			want: true,
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("refresh: %w", oauthErr),
+			code: ErrorCodeInvalidGrant,
+			want: true,
+		},
+		{
+			name: "other code",
+			err:  oauthErr,
+			code: ErrorCodeInvalidClient,
+		},
+		{
+			name: "without code",
+			err:  NewOAuthError(http.StatusBadGateway, []byte("bad gateway")),
+			code: ErrorCodeInvalidGrant,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsErrorCode(tt.err, tt.code); got != tt.want {
+				t.Errorf("IsErrorCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeToken(t *testing.T) {
+	tests := []struct {
+		name              string
+		body              string
+		err               error
+		wantExpiry        time.Duration
+		wantRefreshExpiry time.Duration
+		wantErr           bool
+	}{
+		{
+			name:              "expiry",
+			body:              `{"access_token":"token","expires_in":300,"refresh_token":"refresh","refresh_expires_in":1800}`,
+			wantExpiry:        300 * time.Second,
+			wantRefreshExpiry: 1800 * time.Second,
+		},
+		{
+			name: "without expiry",
+			body: `{"access_token":"token"}`,
+		},
+		{
+			name:    "without access token",
+			body:    `{"expires_in":300}`,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			body:    "token",
+			wantErr: true,
+		},
+		{
+			name:    "request error",
+			err:     NewOAuthError(http.StatusBadRequest, []byte(`{"error":"invalid_grant"}`)),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+
+			token, err := DecodeToken([]byte(tt.body), tt.err)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("DecodeToken() error = %v, want %v", err, tt.err)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			after := time.Now()
+
+			for _, v := range []struct {
+				name string
+				got  time.Time
+				want time.Duration
+			}{
+				{name: "Expiry", got: token.Expiry, want: tt.wantExpiry},
+				{name: "RefreshExpiry", got: token.RefreshExpiry, want: tt.wantRefreshExpiry},
+			} {
+				if v.want == 0 {
+					if !v.got.IsZero() {
+						t.Errorf("%s = %v, want zero", v.name, v.got)
+					}
+
+					continue
+				}
+
+				if v.got.Before(before.Add(v.want)) || v.got.After(after.Add(v.want)) {
+					t.Errorf("%s = %v, want between %v and %v", v.name, v.got, before.Add(v.want), after.Add(v.want))
+				}
+			}
+
+			if string(token.Raw) != tt.body {
+				t.Errorf("Raw = %s, want %s", token.Raw, tt.body)
+			}
+		})
+	}
+}
+
+func TestAuthRequestConfig_endpoint(t *testing.T) {
+	const (
+		tokenURL    = "https://localhost/token"
+		endpointURL = "https://localhost/revoke"
+	)
+
+	var audience string
+	assertion := func(_, aud string) (string, error) {
+		audience = aud
+
+		return "assertion", nil
+	}
+
+	tests := []struct {
+		name         string
+		cfg          AuthRequestConfig
+		wantBasic    bool
+		wantForm     url.Values
+		wantAudience string
+	}{
+		{
+			name: "public client",
+			cfg: AuthRequestConfig{
+				TokenURL: tokenURL,
+				ClientID: "public",
+			},
+			wantForm: url.Values{"client_id": {"public"}},
+		},
+		{
+			name: "confidential client",
+			cfg: AuthRequestConfig{
+				TokenURL:     tokenURL,
+				ClientID:     "test",
+				ClientSecret: "secret",
+			},
+			wantBasic: true,
+			wantForm:  url.Values{},
+		},
+		{
+			name: "confidential client body",
+			cfg: AuthRequestConfig{
+				TokenURL:        tokenURL,
+				ClientID:        "test",
+				ClientSecret:    "secret",
+				AuthHeaderStyle: AuthHeaderStyleBody,
+			},
+			wantForm: url.Values{"client_id": {"test"}, "client_secret": {"secret"}},
+		},
+		{
+			name: "client assertion",
+			cfg: AuthRequestConfig{
+				TokenURL:        tokenURL,
+				ClientID:        "test",
+				ClientAssertion: assertion,
+			},
+			wantForm: url.Values{
+				"client_id":             {"test"},
+				"client_assertion_type": {ClientAssertionTypeJWTBearer},
+				"client_assertion":      {"assertion"},
+			},
+			wantAudience: tokenURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audience = ""
+
+			req, err := newAuthRequest(context.Background(), url.Values{}, tt.cfg.endpoint(endpointURL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if req.URL.String() != endpointURL {
+				t.Errorf("URL = %s, want %s", req.URL, endpointURL)
+			}
+
+			if _, _, ok := req.BasicAuth(); ok != tt.wantBasic {
+				t.Errorf("basic auth = %v, want %v", ok, tt.wantBasic)
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(body); got != tt.wantForm.Encode() {
+				t.Errorf("form = %s, want %s", got, tt.wantForm.Encode())
+			}
+
+			if audience != tt.wantAudience {
+				t.Errorf("assertion audience = %q, want %q", audience, tt.wantAudience)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Error codes of the token endpoint, RFC 6749 section 5.2 and RFC 8628 section 3.5.
+const (
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeInvalidClient        = "invalid_client"
+	ErrorCodeInvalidGrant         = "invalid_grant"
+	ErrorCodeUnauthorizedClient   = "unauthorized_client"
+	ErrorCodeUnsupportedGrantType = "unsupported_grant_type"
+	ErrorCodeInvalidScope         = "invalid_scope"
+	ErrorCodeAuthorizationPending = "authorization_pending"
+	ErrorCodeSlowDown             = "slow_down"
+	ErrorCodeAccessDenied         = "access_denied"
+	ErrorCodeExpiredToken         = "expired_token"
+)
+
+// OAuthError is the error response of the non 2xx status codes.
+type OAuthError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int `json:"-"`
+	// ErrorCode is empty if the body is not an error response, like invalid_grant.
+	ErrorCode        string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	ErrorURI         string `json:"error_uri,omitempty"`
+	// Body is the raw response body.
+	Body []byte `json:"-"`
+}
+
+// NewOAuthError returns the error with parsing the body, body is kept as is if not JSON.
+func NewOAuthError(statusCode int, body []byte) *OAuthError {
+	e := &OAuthError{}
+	_ = json.Unmarshal(body, e)
+
+	e.StatusCode = statusCode
+	e.Body = body
+
+	return e
+}
+
+func (e *OAuthError) Error() string {
+	if e.ErrorCode == "" {
+		if len(e.Body) == 0 {
+			return "status code " + strconv.Itoa(e.StatusCode)
+		}
+
+		return string(e.Body)
+	}
+
+	if e.ErrorDescription == "" {
+		return fmt.Sprintf("%s (status code %d)", e.ErrorCode, e.StatusCode)
+	}
+
+	return fmt.Sprintf("%s: %s (status code %d)", e.ErrorCode, e.ErrorDescription, e.StatusCode)
+}
+
+// IsErrorCode reports the error is an *OAuthError with the error code.
+//
+//	if request.IsErrorCode(err, request.ErrorCodeInvalidGrant) {
+//		// refresh token is not valid anymore, login again
+//	}
+func IsErrorCode(err error, code string) bool {
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		return false
+	}
+
+	return oauthErr.ErrorCode == code
+}
+
+// TokenResponse is the successful response of the token endpoint.
+type TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type,omitempty"`
+	ExpiresIn        int    `json:"expires_in,omitempty"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	RefreshExpiresIn int    `json:"refresh_expires_in,omitempty"`
+	IDToken          string `json:"id_token,omitempty"`
+	Scope            string `json:"scope,omitempty"`
+	// IssuedTokenType is set by token exchange.
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+
+	// Expiry is the absolute expiry of the access token computed at receipt, zero if ExpiresIn not set.
+	Expiry time.Time `json:"-"`
+	// RefreshExpiry is the absolute expiry of the refresh token, zero if RefreshExpiresIn not set.
+	RefreshExpiry time.Time `json:"-"`
+
+	// Raw is the response body.
+	Raw []byte `json:"-"`
+}
+
+// DecodeToken decodes the response of the flows, error is returned as is.
+//
+//	token, err := request.DecodeToken(authClient.ClientCredentials(ctx, cfg))
+func DecodeToken(body []byte, err error) (*TokenResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	t := &TokenResponse{}
+	if err := json.Unmarshal(body, t); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token response: %w", err)
+	}
+
+	if t.AccessToken == "" {
+		return nil, fmt.Errorf("access_token not found in the response")
+	}
+
+	if t.ExpiresIn > 0 {
+		t.Expiry = now.Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+
+	if t.RefreshExpiresIn > 0 {
+		t.RefreshExpiry = now.Add(time.Duration(t.RefreshExpiresIn) * time.Second)
+	}
+
+	t.Raw = body
+
+	return t, nil
+}
+
+// OAuth2Token returns the token to use in oauth2 token sources and transports.
+func (t *TokenResponse) OAuth2Token() *oauth2.Token {
+	token := &oauth2.Token{
+		AccessToken:  t.AccessToken,
+		TokenType:    t.TokenType,
+		RefreshToken: t.RefreshToken,
+		Expiry:       t.Expiry,
+	}
+
+	if t.IDToken != "" {
+		token = token.WithExtra(map[string]interface{}{
+			"id_token": t.IDToken,
+		})
+	}
+
+	return token
+}
@@ -0,0 +1,40 @@
+package request
+
+import (
+	"context"
+	"net/url"
+)
+
+// Token type hints of the revocation and introspection requests.
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+type RevokeConfig struct {
+	// RevocationURL is the token revocation endpoint.
+	RevocationURL string
+	// Token to revoke, access or refresh token.
+	Token string
+	// TokenTypeHint is optional, TokenTypeHintAccessToken or TokenTypeHintRefreshToken.
+	TokenTypeHint string
+
+	AuthRequestConfig
+}
+
+// Revoke is a function to revoke the access or refresh token, RFC 7009.
+//
+// Client authentication is same as the token endpoint, TokenURL is used as audience of the client assertion.
+func (a *Auth) Revoke(ctx context.Context, cfg RevokeConfig) error {
+	uValues := url.Values{
+		"token": {cfg.Token},
+	}
+
+	if cfg.TokenTypeHint != "" {
+		uValues.Set("token_type_hint", cfg.TokenTypeHint)
+	}
+
+	_, err := a.AuthRequest(ctx, uValues, cfg.AuthRequestConfig.endpoint(cfg.RevocationURL))
+
+	return err
+}
@@ -0,0 +1,113 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	GrantTypeUMATicket = "urn:ietf:params:oauth:grant-type:uma-ticket"
+
+	// UMAResponseModeDecision returns {"result": true} instead of RPT.
+	UMAResponseModeDecision = "decision"
+	// UMAResponseModePermissions returns list of granted permissions instead of RPT.
+	UMAResponseModePermissions = "permissions"
+)
+
+type UMATicketConfig struct {
+	// AccessToken of the user, if set it is used as Bearer instead of the client authentication.
+	AccessToken string
+	// Audience is the client id of the resource server.
+	Audience string
+	// Permissions list in "resource#scope" format, scope part is optional.
+	Permissions []string
+	// Ticket is the permission ticket from the resource server, optional.
+	Ticket string
+	// ResponseMode is empty for RPT, "decision" or "permissions".
+	ResponseMode string
+
+	// EndpointParams specifies additional parameters for requests to the token endpoint.
+	EndpointParams url.Values
+
+	AuthRequestConfig
+}
+
+// UMADecisionResponse is the response of the decision response mode.
+type UMADecisionResponse struct {
+	Result bool `json:"result"`
+}
+
+// UMATicket is a function to handle UMA ticket grant of keycloak authorization services.
+//
+// Returns a byte array of the response body, if the response status code is 2xx.
+func (a *Auth) UMATicket(ctx context.Context, cfg UMATicketConfig) ([]byte, error) {
+	_, body, err := a.umaTicket(ctx, cfg)
+
+	return body, err
+}
+
+// UMADecision asks the decision of the permissions to the token endpoint.
+//
+// Returns false without error if the permission is denied.
+func (a *Auth) UMADecision(ctx context.Context, cfg UMATicketConfig) (bool, error) {
+	cfg.ResponseMode = UMAResponseModeDecision
+
+	code, body, err := a.umaTicket(ctx, cfg)
+	if err != nil {
+		if code == http.StatusForbidden {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	var decision UMADecisionResponse
+	if err := json.Unmarshal(body, &decision); err != nil {
+		return false, fmt.Errorf("failed to unmarshal decision: %w", err)
+	}
+
+	return decision.Result, nil
+}
+
+func (a *Auth) umaTicket(ctx context.Context, cfg UMATicketConfig) (int, []byte, error) {
+	uValues := url.Values{
+		"grant_type": {GrantTypeUMATicket},
+	}
+
+	if cfg.Audience != "" {
+		uValues.Set("audience", cfg.Audience)
+	}
+	if cfg.Ticket != "" {
+		uValues.Set("ticket", cfg.Ticket)
+	}
+	if cfg.ResponseMode != "" {
+		uValues.Set("response_mode", cfg.ResponseMode)
+	}
+	for _, permission := range cfg.Permissions {
+		uValues.Add("permission", permission)
+	}
+	for k, p := range cfg.EndpointParams {
+		uValues[k] = p
+	}
+
+	var req *http.Request
+	var err error
+	if cfg.AccessToken != "" {
+		req, err = newFormRequest(ctx, cfg.TokenURL, uValues)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		SetBearerAuth(req, cfg.AccessToken)
+	} else {
+		req, err = newAuthRequest(ctx, uValues, cfg.AuthRequestConfig)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return rawRequestStatus(req, a.client())
+}
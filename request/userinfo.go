@@ -0,0 +1,28 @@
+package request
+
+import (
+	"context"
+	"net/http"
+)
+
+type UserInfoConfig struct {
+	// UserInfoURL is the OpenID Connect userinfo endpoint.
+	UserInfoURL string
+	// AccessToken of the user.
+	AccessToken string
+}
+
+// UserInfo is a function to get the claims of the access token from the userinfo endpoint.
+//
+// Returns a byte array of the JSON response body, if the response status code is 2xx.
+func (a *Auth) UserInfo(ctx context.Context, cfg UserInfoConfig) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("accept", "application/json")
+	SetBearerAuth(req, cfg.AccessToken)
+
+	return a.RawRequest(req)
+}
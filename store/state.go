@@ -2,6 +2,7 @@ package store
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 )
 
@@ -17,3 +18,21 @@ func NewState() (string, error) {
 
 	return base64State, nil
 }
+
+// NewCodeVerifier generates a PKCE code verifier, RFC 7636.
+func NewCodeVerifier() (string, error) {
+	cryptoRandBytes := make([]byte, 32)
+	_, err := rand.Read(cryptoRandBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(cryptoRandBytes), nil
+}
+
+// CodeChallengeS256 returns the S256 code challenge of the code verifier.
+func CodeChallengeS256(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -8,12 +8,19 @@ import (
 )
 
 // DefaultExpireDuration is the default duration to check if the access token is about to expire.
+//
+// It is read in every IsRefreshNeed call, set it only at startup or use IsRefreshNeedWithin.
 var DefaultExpireDuration = time.Second * 10
 
 type Token = oauth2.Token
 
-// IsRefreshNeed checks if the access token is about to expire.
+// IsRefreshNeed checks if the access token expires in DefaultExpireDuration.
 func IsRefreshNeed(accessToken string) (bool, error) {
+	return IsRefreshNeedWithin(accessToken, DefaultExpireDuration)
+}
+
+// IsRefreshNeedWithin checks if the access token expires in the given duration.
+func IsRefreshNeedWithin(accessToken string, d time.Duration) (bool, error) {
 	claims := jwt.RegisteredClaims{}
 
 	_, _, err := jwt.NewParser().ParseUnverified(accessToken, &claims)
@@ -26,5 +33,10 @@ func IsRefreshNeed(accessToken string) (bool, error) {
 		return false, err
 	}
 
-	return v.Before(time.Now().Add(DefaultExpireDuration)), nil
+	// token without expiration
+	if v == nil {
+		return false, nil
+	}
+
+	return v.Before(time.Now().Add(d)), nil
 }
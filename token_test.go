@@ -50,6 +50,16 @@ func TestIsRefreshNeed(t *testing.T) {
 			want:    false,
 			wantErr: false,
 		},
+		{
+			name: "no expiration",
+			args: args{
+				token: jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+					Subject: "test",
+				}),
+			},
+			want:    false,
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,531 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenKey selects the token of the TokenManager.
+//
+// Zero value is the provider's default token.
+type TokenKey struct {
+	// Scopes of the token, nil uses the provider's scopes.
+	Scopes []string
+	// Audience is sent as audience parameter, like keycloak's client id of the target.
+	Audience string
+	// Resource indicators of the target services, RFC 8707.
+	Resource []string
+	// EndpointParams are additional parameters of the token request.
+	EndpointParams url.Values
+}
+
+// String returns the canonical form of the key, same keys with different orders are equal.
+func (k TokenKey) String() string {
+	values := url.Values{}
+	for key, v := range k.EndpointParams {
+		values[key] = append([]string(nil), v...)
+	}
+
+	if k.Scopes != nil {
+		scopes := append([]string(nil), k.Scopes...)
+		sort.Strings(scopes)
+		values.Set("scope", strings.Join(scopes, " "))
+	}
+
+	if k.Audience != "" {
+		values.Set("audience", k.Audience)
+	}
+
+	if len(k.Resource) > 0 {
+		resource := append([]string(nil), k.Resource...)
+		sort.Strings(resource)
+		values["resource"] = resource
+	}
+
+	// Encode sorts by key
+	return values.Encode()
+}
+
+// DefaultTokenManagerMax is the maximum count of the keys kept by the TokenManager.
+var DefaultTokenManagerMax = 1000
+
+// DefaultTokenIdleTimeout is the duration to keep the token of an unused key in the TokenManager.
+var DefaultTokenIdleTimeout = 30 * time.Minute
+
+// TokenFetchFunc gets a new token of the key.
+type TokenFetchFunc func(ctx context.Context, key TokenKey) (*oauth2.Token, error)
+
+// TokenManager holds tokens per key in a shared cache.
+//
+// Only one token request is sent at a time for a key, others wait for its result or their context.
+// Keys not used in DefaultTokenIdleTimeout are removed, the least recently used key is removed at DefaultTokenManagerMax.
+type TokenManager struct {
+	ctx   context.Context
+	fetch TokenFetchFunc
+	max   int
+	idle  time.Duration
+
+	mutex   sync.Mutex
+	tokens  map[string]*managedToken
+	refresh *optionsRefresh
+	// used orders the entries, front is the most recently used.
+	used *list.List
+}
+
+type managedToken struct {
+	key   TokenKey
+	mutex sync.Mutex
+	token *oauth2.Token
+	timer *time.Timer
+	call  *tokenCall
+	// evicted stops the background refresh of the removed entry.
+	evicted bool
+
+	// keyString, lastUsed and element are guarded by the manager's mutex.
+	keyString string
+	lastUsed  time.Time
+	element   *list.Element
+}
+
+// tokenCall is the in-flight token request of the entry, done is closed with the result.
+type tokenCall struct {
+	done  chan struct{}
+	token *oauth2.Token
+	err   error
+}
+
+// NewTokenManager returns a manager getting the tokens with the fetch function.
+func NewTokenManager(ctx context.Context, fetch TokenFetchFunc) *TokenManager {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &TokenManager{
+		ctx:    ctx,
+		fetch:  fetch,
+		max:    DefaultTokenManagerMax,
+		idle:   DefaultTokenIdleTimeout,
+		tokens: make(map[string]*managedToken),
+		used:   list.New(),
+	}
+}
+
+// NewTokenManager returns a token manager with client credentials of the provider.
+//
+// Scopes, audience, resource and endpoint params of the key are added to the token request.
+func (p *ProviderExtra) NewTokenManager(ctx context.Context) *TokenManager {
+	return NewTokenManager(ctx, p.fetchToken)
+}
+
+func (p *ProviderExtra) fetchToken(ctx context.Context, key TokenKey) (*oauth2.Token, error) {
+	cfg, err := p.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err = p.clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Scopes != nil {
+		cfg.Scopes = key.Scopes
+	}
+
+	if len(key.EndpointParams) > 0 || key.Audience != "" || len(key.Resource) > 0 {
+		params := url.Values{}
+		for k, v := range cfg.EndpointParams {
+			params[k] = v
+		}
+
+		for k, v := range key.EndpointParams {
+			params[k] = v
+		}
+
+		if key.Audience != "" {
+			params.Set("audience", key.Audience)
+		}
+
+		if len(key.Resource) > 0 {
+			params["resource"] = key.Resource
+		}
+
+		cfg.EndpointParams = params
+	}
+
+	return cfg.TokenSource(ctx).Token()
+}
+
+func (m *TokenManager) entry(key TokenKey) *managedToken {
+	m.mutex.Lock()
+
+	now := time.Now()
+	k := key.String()
+	v, ok := m.tokens[k]
+	if ok {
+		m.used.MoveToFront(v.element)
+		v.lastUsed = now
+	}
+
+	// least recently used entries are at the back, idle ones and the oldest at the limit are removed
+	var evicted []*managedToken
+	for e := m.used.Back(); e != nil && e.Value != v; e = m.used.Back() {
+		old := e.Value.(*managedToken)
+		idle := m.idle > 0 && now.Sub(old.lastUsed) >= m.idle
+		full := !ok && m.max > 0 && len(m.tokens) >= m.max
+		if !idle && !full {
+			break
+		}
+
+		m.used.Remove(e)
+		delete(m.tokens, old.keyString)
+		evicted = append(evicted, old)
+	}
+
+	if !ok {
+		v = &managedToken{key: key, keyString: k, lastUsed: now}
+		v.element = m.used.PushFront(v)
+		m.tokens[k] = v
+	}
+
+	m.mutex.Unlock()
+
+	// entries are locked after the manager, schedule locks them in the reverse order
+	for _, e := range evicted {
+		e.mutex.Lock()
+		e.evicted = true
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		e.mutex.Unlock()
+	}
+
+	return v
+}
+
+// entries returns a copy of the entries to lock them without holding the manager.
+func (m *TokenManager) entries() []*managedToken {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entries := make([]*managedToken, 0, len(m.tokens))
+	for _, v := range m.tokens {
+		entries = append(entries, v)
+	}
+
+	return entries
+}
+
+// Token returns the cached valid token of the key or gets a new one.
+func (m *TokenManager) Token(key TokenKey) (*oauth2.Token, error) {
+	return m.TokenContext(m.ctx, key)
+}
+
+// TokenContext returns the cached valid token of the key or waits the token request until the context is done.
+//
+// Token request uses the context of the manager and is shared by all waiting calls of the key.
+func (m *TokenManager) TokenContext(ctx context.Context, key TokenKey) (*oauth2.Token, error) {
+	entry := m.entry(key)
+
+	entry.mutex.Lock()
+	if entry.token.Valid() {
+		token := entry.token
+		entry.mutex.Unlock()
+
+		return token, nil
+	}
+
+	call := entry.call
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		entry.call = call
+
+		go m.fetchEntry(entry, call)
+	}
+	entry.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetchEntry gets a new token of the entry and ends the call with the result.
+func (m *TokenManager) fetchEntry(entry *managedToken, call *tokenCall) {
+	issued := time.Now()
+	token, err := m.fetch(m.ctx, entry.key)
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	entry.call = nil
+	if err == nil {
+		entry.token = token
+		m.schedule(entry, issued)
+	}
+
+	call.token, call.err = token, err
+	close(call.done)
+}
+
+// Invalidate drops the cached token of the key if it is still the given token.
+//
+// Tokens already replaced by another request are kept, so concurrent rejections get one new token.
+func (m *TokenManager) Invalidate(key TokenKey, token *oauth2.Token) {
+	entry := m.entry(key)
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	if entry.token != nil && token != nil && entry.token.AccessToken == token.AccessToken {
+		entry.token = nil
+	}
+}
+
+// StartRefresh renews the tokens in the background before they expire, until the context of the manager is done.
+//
+// Requests get the current token while the refresh is in flight, failed refreshes are retried until the token expires.
+func (m *TokenManager) StartRefresh(opts ...OptionRefresh) {
+	options := optionsRefresh{
+		fraction: DefaultRefreshFraction,
+		jitter:   DefaultRefreshJitter,
+		retry:    DefaultRefreshRetry,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	m.mutex.Lock()
+	started := m.refresh != nil
+	m.refresh = &options
+	m.mutex.Unlock()
+
+	// schedule the cached tokens with the remaining lifetime
+	for _, entry := range m.entries() {
+		entry.mutex.Lock()
+		m.schedule(entry, time.Now())
+		entry.mutex.Unlock()
+	}
+
+	if started {
+		return
+	}
+
+	go func() {
+		<-m.ctx.Done()
+
+		for _, entry := range m.entries() {
+			entry.mutex.Lock()
+			if entry.timer != nil {
+				entry.timer.Stop()
+			}
+			entry.mutex.Unlock()
+		}
+	}()
+}
+
+// schedule sets the background refresh of the entry's token, entry must be locked.
+func (m *TokenManager) schedule(entry *managedToken, issued time.Time) {
+	m.mutex.Lock()
+	refresh := m.refresh
+	m.mutex.Unlock()
+
+	if refresh == nil || m.ctx.Err() != nil || entry.token == nil || entry.token.Expiry.IsZero() {
+		return
+	}
+
+	lifetime := entry.token.Expiry.Sub(issued)
+	if lifetime <= 0 {
+		return
+	}
+
+	wait := time.Duration(float64(lifetime) * refresh.fraction)
+	if refresh.jitter > 0 {
+		wait += time.Duration((rand.Float64()*2 - 1) * refresh.jitter * float64(lifetime))
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	if wait > lifetime {
+		wait = lifetime
+	}
+
+	m.after(entry, wait)
+}
+
+// after runs the refresh of the entry after the duration, entry must be locked.
+func (m *TokenManager) after(entry *managedToken, d time.Duration) {
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+
+	if entry.evicted {
+		return
+	}
+
+	entry.timer = time.AfterFunc(d, func() {
+		m.refreshEntry(entry)
+	})
+}
+
+// refreshEntry gets a new token without blocking the requests using the current token.
+func (m *TokenManager) refreshEntry(entry *managedToken) {
+	if m.ctx.Err() != nil {
+		return
+	}
+
+	issued := time.Now()
+	token, err := m.fetch(m.ctx, entry.key)
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	if err != nil {
+		m.mutex.Lock()
+		refresh := m.refresh
+		m.mutex.Unlock()
+
+		if refresh.onError != nil {
+			refresh.onError(entry.key, err)
+		}
+
+		// retry while the current token is usable, requests get a new one after that
+		if entry.token.Valid() && m.ctx.Err() == nil {
+			wait := refresh.retry
+			if remain := time.Until(entry.token.Expiry) / 2; remain < wait {
+				wait = remain
+			}
+
+			m.after(entry, wait)
+		}
+
+		return
+	}
+
+	entry.token = token
+	m.schedule(entry, issued)
+}
+
+// TokenSource returns a token source of the key sharing the cache.
+//
+// Returned source is a TokenInvalidator and TokenContextSource.
+func (m *TokenManager) TokenSource(key TokenKey) oauth2.TokenSource {
+	return managerTokenSource{
+		manager: m,
+		key:     key,
+	}
+}
+
+type managerTokenSource struct {
+	manager *TokenManager
+	key     TokenKey
+}
+
+func (s managerTokenSource) Token() (*oauth2.Token, error) {
+	return s.manager.Token(s.key)
+}
+
+func (s managerTokenSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	return s.manager.TokenContext(ctx, s.key)
+}
+
+func (s managerTokenSource) Invalidate(token *oauth2.Token) {
+	s.manager.Invalidate(s.key, token)
+}
+
+type ctxTokenKey struct{}
+
+// WithTokenKey returns a context to select the token of the request in OAuth2Shared.RoundTripperContext.
+func WithTokenKey(ctx context.Context, key TokenKey) context.Context {
+	return context.WithValue(ctx, ctxTokenKey{}, key)
+}
+
+// TokenKeyFromContext returns the token key of the context.
+func TokenKeyFromContext(ctx context.Context) (TokenKey, bool) {
+	key, ok := ctx.Value(ctxTokenKey{}).(TokenKey)
+
+	return key, ok
+}
+
+// sourceTransport adds the token of the source selected per request.
+type sourceTransport struct {
+	base   http.RoundTripper
+	source func(req *http.Request) oauth2.TokenSource
+}
+
+func (t *sourceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := &Oauth2Transport{
+		Transport: oauth2.Transport{
+			Source: t.source(req),
+			Base:   t.base,
+		},
+	}
+
+	return transport.RoundTrip(req)
+}
+
+// Defaults of the background refresh.
+var (
+	// DefaultRefreshFraction is the fraction of the token lifetime to renew the token.
+	DefaultRefreshFraction = 0.75
+	// DefaultRefreshJitter is the random fraction of the lifetime added or removed to spread the renewals.
+	DefaultRefreshJitter = 0.05
+	// DefaultRefreshRetry is the maximum wait to retry a failed refresh.
+	DefaultRefreshRetry = 10 * time.Second
+)
+
+type optionsRefresh struct {
+	fraction float64
+	jitter   float64
+	retry    time.Duration
+	onError  func(key TokenKey, err error)
+}
+
+type OptionRefresh func(*optionsRefresh)
+
+// WithRefreshFraction sets the fraction of the token lifetime to renew the token, default is DefaultRefreshFraction.
+func WithRefreshFraction(v float64) OptionRefresh {
+	return func(opts *optionsRefresh) {
+		if v > 0 && v <= 1 {
+			opts.fraction = v
+		}
+	}
+}
+
+// WithRefreshJitter sets the random fraction of the lifetime, default is DefaultRefreshJitter, 0 disables.
+func WithRefreshJitter(v float64) OptionRefresh {
+	return func(opts *optionsRefresh) {
+		if v >= 0 && v < 1 {
+			opts.jitter = v
+		}
+	}
+}
+
+// WithRefreshRetry sets the maximum wait to retry a failed refresh, default is DefaultRefreshRetry.
+func WithRefreshRetry(d time.Duration) OptionRefresh {
+	return func(opts *optionsRefresh) {
+		if d > 0 {
+			opts.retry = d
+		}
+	}
+}
+
+// WithRefreshError sets the callback of the failed refreshes, like logging or metrics.
+func WithRefreshError(fn func(key TokenKey, err error)) OptionRefresh {
+	return func(opts *optionsRefresh) {
+		opts.onError = fn
+	}
+}
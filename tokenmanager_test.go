@@ -0,0 +1,356 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/worldline-go/auth/providers"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenKey_String(t *testing.T) {
+	tests := []struct {
+		name string
+		a    TokenKey
+		b    TokenKey
+		want bool
+	}{
+		{
+			name: "scope order",
+			a:    TokenKey{Scopes: []string{"read", "write"}},
+			b:    TokenKey{Scopes: []string{"write", "read"}},
+			want: true,
+		},
+		{
+			name: "resource order",
+			a:    TokenKey{Resource: []string{"https://a", "https://b"}},
+			b:    TokenKey{Resource: []string{"https://b", "https://a"}},
+			want: true,
+		},
+		{
+			name: "nil and empty scopes",
+			a:    TokenKey{},
+			b:    TokenKey{Scopes: []string{}},
+			want: false,
+		},
+		{
+			name: "audience",
+			a:    TokenKey{Audience: "a"},
+			b:    TokenKey{EndpointParams: url.Values{"audience": {"a"}}},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.String() == tt.b.String(); got != tt.want {
+				t.Errorf("%q == %q is %v, want %v", tt.a.String(), tt.b.String(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOAuth2Shared_Manager(t *testing.T) {
+	var calls sync.Map
+
+	serverToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		audience := r.PostForm.Get("audience") + r.PostForm.Get("resource")
+		v, _ := calls.LoadOrStore(audience, new(int32))
+		count := atomic.AddInt32(v.(*int32), 1)
+
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%s-%d","token_type":"bearer","expires_in":3600}`, audience, count)
+	}))
+	defer serverToken.Close()
+
+	serverAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer serverAPI.Close()
+
+	authService := Provider{
+		Keycloak: &providers.KeyCloak{
+			TokenURL:     serverToken.URL,
+			ClientID:     "test",
+			ClientSecret: "test-secret",
+		},
+	}
+
+	shared, err := authService.ActiveProvider().NewOauth2Shared(context.Background())
+	if err != nil {
+		t.Fatalf("NewOauth2Shared() error = %v", err)
+	}
+
+	// concurrent requests of the same key send one token request
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := shared.Manager.Token(TokenKey{Audience: "api"}); err != nil {
+				t.Errorf("Token() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := calls.Load("api"); v == nil || atomic.LoadInt32(v.(*int32)) != 1 {
+		t.Fatalf("token requests of api audience, want 1")
+	}
+
+	apiURL, _ := url.Parse(serverAPI.URL)
+
+	get := func(t *testing.T, transport http.RoundTripper, ctx context.Context) string {
+		t.Helper()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, serverAPI.URL, nil)
+		resp, err := (&http.Client{Transport: transport}).Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		defer resp.Body.Close()
+
+		var b [128]byte
+		n, _ := resp.Body.Read(b[:])
+
+		return string(b[:n])
+	}
+
+	t.Run("hosts", func(t *testing.T) {
+		transport, err := shared.RoundTripperHosts(context.Background(), http.DefaultTransport, map[string]TokenKey{
+			apiURL.Hostname(): {Audience: "api"},
+		})
+		if err != nil {
+			t.Fatalf("RoundTripperHosts() error = %v", err)
+		}
+
+		if got := get(t, transport, context.Background()); got != "Bearer token-api-1" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer token-api-1")
+		}
+
+		transport, err = shared.RoundTripperHosts(context.Background(), http.DefaultTransport, map[string]TokenKey{
+			"other.example.com": {Audience: "other"},
+		})
+		if err != nil {
+			t.Fatalf("RoundTripperHosts() error = %v", err)
+		}
+
+		if got := get(t, transport, context.Background()); got != "Bearer token--1" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer token--1")
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		transport, err := shared.RoundTripperContext(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("RoundTripperContext() error = %v", err)
+		}
+
+		ctx := WithTokenKey(context.Background(), TokenKey{Resource: []string{"https://resource"}})
+		if got := get(t, transport, ctx); got != "Bearer token-https://resource-1" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer token-https://resource-1")
+		}
+
+		if got := get(t, transport, context.Background()); got != "Bearer token--1" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer token--1")
+		}
+	})
+}
+
+func TestTokenManager_StartRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+
+	var calls int32
+	manager := NewTokenManager(ctx, func(_ context.Context, _ TokenKey) (*oauth2.Token, error) {
+		count := atomic.AddInt32(&calls, 1)
+		if count == 2 {
+			close(inFlight)
+			<-release
+
+			return nil, errors.New("token endpoint down")
+		}
+
+		return &oauth2.Token{
+			AccessToken: fmt.Sprintf("token-%d", count),
+			Expiry:      time.Now().Add(time.Hour),
+		}, nil
+	})
+
+	refreshErr := make(chan error, 1)
+	manager.StartRefresh(
+		// renew after ~360ms of the hour
+		WithRefreshFraction(0.0001),
+		WithRefreshJitter(0),
+		WithRefreshRetry(10*time.Millisecond),
+		WithRefreshError(func(_ TokenKey, err error) {
+			select {
+			case refreshErr <- err:
+			default:
+			}
+		}),
+	)
+
+	token, err := manager.Token(TokenKey{})
+	if err != nil || token.AccessToken != "token-1" {
+		t.Fatalf("Token() = %v, %v, want token-1", token, err)
+	}
+
+	select {
+	case <-inFlight:
+	case <-time.After(5 * time.Second):
+		t.Fatal("background refresh not started")
+	}
+
+	// old token is served while the refresh is in flight
+	token, err = manager.Token(TokenKey{})
+	if err != nil || token.AccessToken != "token-1" {
+		t.Fatalf("Token() = %v, %v, want token-1", token, err)
+	}
+
+	close(release)
+
+	select {
+	case err := <-refreshErr:
+		if err == nil || err.Error() != "token endpoint down" {
+			t.Errorf("refresh error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh error not reported")
+	}
+
+	// failed refresh is retried
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		token, err = manager.Token(TokenKey{})
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+
+		if token.AccessToken == "token-3" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Token() = %v, want token-3 after retry", token.AccessToken)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+}
+
+func TestTokenManager_TokenContext(t *testing.T) {
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+
+	var calls int32
+	manager := NewTokenManager(context.Background(), func(_ context.Context, _ TokenKey) (*oauth2.Token, error) {
+		atomic.AddInt32(&calls, 1)
+		close(inFlight)
+		<-release
+
+		return &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, nil
+	})
+
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := manager.Token(TokenKey{})
+		waiter <- err
+	}()
+
+	<-inFlight
+
+	// canceled request doesn't wait the token request of the other call
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := manager.TokenContext(ctx, TokenKey{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("TokenContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+
+	if err := <-waiter; err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	if token, err := manager.TokenContext(context.Background(), TokenKey{}); err != nil || token.AccessToken != "token" {
+		t.Fatalf("TokenContext() = %v, %v, want token", token, err)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+}
+
+func TestTokenManager_Evict(t *testing.T) {
+	var fetches int32
+	m := NewTokenManager(context.Background(), func(_ context.Context, key TokenKey) (*oauth2.Token, error) {
+		atomic.AddInt32(&fetches, 1)
+
+		return &oauth2.Token{AccessToken: key.Audience, Expiry: time.Now().Add(time.Hour)}, nil
+	})
+
+	token := func(t *testing.T, audience string) {
+		t.Helper()
+
+		if _, err := m.Token(TokenKey{Audience: audience}); err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+	}
+
+	t.Run("max", func(t *testing.T) {
+		m.max = 2
+		atomic.StoreInt32(&fetches, 0)
+
+		for _, audience := range []string{"a", "b", "a", "c", "a", "b"} {
+			token(t, audience)
+		}
+
+		// b is the least recently used when c is added, a is kept
+		if got := atomic.LoadInt32(&fetches); got != 4 {
+			t.Errorf("fetches = %d, want 4", got)
+		}
+
+		if got := len(m.tokens); got != 2 {
+			t.Errorf("entries = %d, want 2", got)
+		}
+	})
+
+	t.Run("idle", func(t *testing.T) {
+		m.max = 0
+		m.idle = 20 * time.Millisecond
+
+		token(t, "a")
+		time.Sleep(2 * m.idle)
+		token(t, "b")
+
+		m.mutex.Lock()
+		_, ok := m.tokens[TokenKey{Audience: "a"}.String()]
+		count := len(m.tokens)
+		m.mutex.Unlock()
+
+		if ok || count != 1 {
+			t.Errorf("entries = %d, idle entry kept %v", count, ok)
+		}
+	})
+}
@@ -2,23 +2,130 @@ package auth
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"sync"
 
+	"github.com/rs/zerolog/log"
+	"github.com/worldline-go/auth/request"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
+// TokenInvalidator is a token source that can drop its cached token.
+type TokenInvalidator interface {
+	// Invalidate drops the cached token if it is still the given token, next Token call gets a new one.
+	Invalidate(token *oauth2.Token)
+}
+
+// TokenContextSource is a token source waiting the token with the context of the request.
+type TokenContextSource interface {
+	// TokenContext returns the token like Token, it returns the context error when the context is done first.
+	TokenContext(ctx context.Context) (*oauth2.Token, error)
+}
+
 // Oauth2Transport wraps oauth2.Transport to suspend CancelRequest.
+//
+// If the Source is a TokenInvalidator, request is retried once with a new token
+// when the server rejects the token with invalid_token error.
+// TokenContextSource waits the token with the context of the request.
 type Oauth2Transport struct {
 	Transport oauth2.Transport
 }
 
 func (t *Oauth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	return t.Transport.RoundTrip(req)
+	invalidator, ok := t.Transport.Source.(TokenInvalidator)
+	if !ok {
+		return t.Transport.RoundTrip(req)
+	}
+
+	base := t.Transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	for retry := true; ; retry = false {
+		token, err := SourceToken(req.Context(), t.Transport.Source)
+		if err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+
+			return nil, err
+		}
+
+		reqToken := req.Clone(req.Context())
+		token.SetAuthHeader(reqToken)
+
+		resp, err := base.RoundTrip(reqToken)
+		if err != nil {
+			return nil, err
+		}
+
+		if !retry || !isInvalidToken(resp) {
+			return resp, nil
+		}
+
+		// next requests get a new token even if this one cannot be retried
+		invalidator.Invalidate(token)
+
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+	}
+}
+
+// SourceToken gets the token with the context if the source is a TokenContextSource, otherwise with Token.
+func SourceToken(ctx context.Context, source oauth2.TokenSource) (*oauth2.Token, error) {
+	if v, ok := source.(TokenContextSource); ok {
+		return v.TokenContext(ctx)
+	}
+
+	return source.Token()
+}
+
+// isInvalidToken reports the response rejects the token, RFC 6750 section 3.1.
+func isInvalidToken(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+
+	for _, v := range resp.Header.Values("WWW-Authenticate") {
+		scheme, params, _ := strings.Cut(v, " ")
+		if !strings.EqualFold(scheme, "Bearer") && !strings.EqualFold(scheme, request.TokenTypeDPoP) {
+			continue
+		}
+
+		if strings.Contains(params, `error="invalid_token"`) {
+			return true
+		}
+	}
+
+	return false
 }
 
 type OAuth2Shared struct {
 	Source oauth2.TokenSource
+	// DPoP adds proofs to the requests with the token, optional.
+	DPoP *request.DPoP
+	// Manager holds the tokens of the other scopes and audiences, Source is its default token.
+	Manager *TokenManager
 }
 
 // RoundTripper returns a new RoundTripper that adds an OAuth2 Transport.
@@ -32,19 +139,106 @@ func (o OAuth2Shared) RoundTripper(_ context.Context, transport http.RoundTrippe
 	return &Oauth2Transport{
 		Transport: oauth2.Transport{
 			Source: o.Source,
-			Base:   transport,
+			Base:   dpopTransport(o.DPoP, transport),
 		},
 	}, nil
 }
 
+// StartRefresh renews the tokens of the Manager in the background, see TokenManager.StartRefresh.
+//
+// Refresh stops when the context of NewOauth2Shared is done, nil Source does nothing like the noop provider.
+func (o OAuth2Shared) StartRefresh(opts ...OptionRefresh) error {
+	if o.Manager == nil {
+		if o.Source == nil {
+			return nil
+		}
+
+		return fmt.Errorf("token manager not set")
+	}
+
+	o.Manager.StartRefresh(opts...)
+
+	return nil
+}
+
+// RoundTripperHosts returns a RoundTripper selecting the token of the destination host.
+//
+// Hosts are matched with host:port first and then the hostname, other hosts use the Source.
+func (o OAuth2Shared) RoundTripperHosts(_ context.Context, transport http.RoundTripper, hosts map[string]TokenKey) (http.RoundTripper, error) {
+	if o.Manager == nil {
+		return nil, fmt.Errorf("token manager not set")
+	}
+
+	keys := make(map[string]TokenKey, len(hosts))
+	for host, key := range hosts {
+		keys[strings.ToLower(host)] = key
+	}
+
+	return &sourceTransport{
+		base: dpopTransport(o.DPoP, transport),
+		source: func(req *http.Request) oauth2.TokenSource {
+			if key, ok := keys[strings.ToLower(req.URL.Host)]; ok {
+				return o.Manager.TokenSource(key)
+			}
+
+			if key, ok := keys[strings.ToLower(req.URL.Hostname())]; ok {
+				return o.Manager.TokenSource(key)
+			}
+
+			return o.Source
+		},
+	}, nil
+}
+
+// RoundTripperContext returns a RoundTripper selecting the token with WithTokenKey of the request context.
+//
+// Requests without a key use the Source.
+func (o OAuth2Shared) RoundTripperContext(_ context.Context, transport http.RoundTripper) (http.RoundTripper, error) {
+	if o.Manager == nil {
+		return nil, fmt.Errorf("token manager not set")
+	}
+
+	return &sourceTransport{
+		base: dpopTransport(o.DPoP, transport),
+		source: func(req *http.Request) oauth2.TokenSource {
+			if key, ok := TokenKeyFromContext(req.Context()); ok {
+				return o.Manager.TokenSource(key)
+			}
+
+			return o.Source
+		},
+	}, nil
+}
+
+// dpopTransport wraps the transport to add DPoP proofs, returns transport as-is if dpop is nil.
+func dpopTransport(dpop *request.DPoP, transport http.RoundTripper) http.RoundTripper {
+	if dpop == nil {
+		return transport
+	}
+
+	return dpop.Transport(transport)
+}
+
+// NewOauth2Shared returns a shared token source with client credentials.
+//
+// Manager of the shared gets the tokens of the other scopes and audiences with the same client.
+//
+// Client config is read in every token request to get the rotated secrets.
 func (p *ProviderExtra) NewOauth2Shared(ctx context.Context) (*OAuth2Shared, error) {
-	cfg, err := p.ClientConfig()
-	if err != nil {
+	if _, err := p.ClientConfig(); err != nil {
 		return nil, err
 	}
 
+	if _, err := p.clientContext(ctx); err != nil {
+		return nil, err
+	}
+
+	manager := p.NewTokenManager(ctx)
+
 	return &OAuth2Shared{
-		Source: oauth2.ReuseTokenSource(nil, cfg.TokenSource(ctx)),
+		Source:  manager.TokenSource(TokenKey{}),
+		DPoP:    p.dpop,
+		Manager: manager,
 	}, nil
 }
 
@@ -52,26 +246,145 @@ func (p *ProviderExtra) NewOauth2Shared(ctx context.Context) (*OAuth2Shared, err
 //
 // Uses provider's ClientConfig.
 func (p *ProviderExtra) RoundTripper(ctx context.Context, transport http.RoundTripper) (http.RoundTripper, error) {
-	cfg, err := p.ClientConfig()
-	if err != nil {
+	if _, err := p.ClientConfig(); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.clientContext(ctx); err != nil {
 		return nil, err
 	}
 
 	return &Oauth2Transport{
 		Transport: oauth2.Transport{
-			Source: oauth2.ReuseTokenSource(nil, cfg.TokenSource(ctx)),
-			Base:   transport,
+			Source: p.NewTokenManager(ctx).TokenSource(TokenKey{}),
+			Base:   dpopTransport(p.dpop, transport),
 		},
 	}, nil
 }
 
 func (p *ProviderExtra) RoundTripperWrapper(cfg *clientcredentials.Config) func(ctx context.Context, transport http.RoundTripper) http.RoundTripper {
 	return func(ctx context.Context, transport http.RoundTripper) http.RoundTripper {
+		if ctxClient, err := p.clientContext(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to set client authentication")
+		} else {
+			ctx = ctxClient
+		}
+
+		manager := NewTokenManager(ctx, func(ctx context.Context, _ TokenKey) (*oauth2.Token, error) {
+			return cfg.TokenSource(ctx).Token()
+		})
+
 		return &Oauth2Transport{
 			Transport: oauth2.Transport{
-				Source: oauth2.ReuseTokenSource(nil, cfg.TokenSource(ctx)),
-				Base:   transport,
+				Source: manager.TokenSource(TokenKey{}),
+				Base:   dpopTransport(p.dpop, transport),
 			},
 		}
 	}
 }
+
+// providerTokenSource gets a token with the current client config of the provider.
+type providerTokenSource struct {
+	ctx      context.Context
+	provider *ProviderExtra
+}
+
+func (p *ProviderExtra) tokenSource(ctx context.Context) oauth2.TokenSource {
+	return &providerTokenSource{
+		ctx:      ctx,
+		provider: p,
+	}
+}
+
+func (s *providerTokenSource) Token() (*oauth2.Token, error) {
+	cfg, err := s.provider.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err := s.provider.clientContext(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.TokenSource(ctx).Token()
+}
+
+// clientContext adds the http client of the policy and client authentication to the context used by oauth2.
+func (p *ProviderExtra) clientContext(ctx context.Context) (context.Context, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	clientAuth, err := p.ClientAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	ctxClient, _ := ctx.Value(oauth2.HTTPClient).(*http.Client)
+
+	base := ctxClient
+	if base == nil {
+		base = p.client
+	}
+
+	client := base
+	if clientAuth != nil {
+		client, err = p.certClients.HTTPClient(clientAuth, base)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// proofs in the token requests to get DPoP bound tokens
+	if p.dpop != nil {
+		client = p.dpop.Client(client)
+	}
+
+	if client == nil || client == ctxClient || client == http.DefaultClient {
+		return ctx, nil
+	}
+
+	return context.WithValue(ctx, oauth2.HTTPClient, client), nil
+}
+
+// certClientCache keeps the client of tls_client_auth to not create a transport in every token request.
+//
+// Client is created again when the certificate changes and idle connections of the old one are closed.
+type certClientCache struct {
+	mutex       sync.Mutex
+	base        *http.Client
+	certificate *tls.Certificate
+	client      *http.Client
+}
+
+// HTTPClient returns the client with the client authentication, see request.ClientAuth.HTTPClient.
+//
+// Nil cache creates a new client.
+func (c *certClientCache) HTTPClient(clientAuth *request.ClientAuth, base *http.Client) (*http.Client, error) {
+	if c == nil || clientAuth.Method != request.AuthMethodTLSClientAuth {
+		return clientAuth.HTTPClient(base)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.client != nil && c.base == base && c.certificate == clientAuth.Certificate {
+		return c.client, nil
+	}
+
+	client, err := clientAuth.HTTPClient(base)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
+
+	c.base = base
+	c.certificate = clientAuth.Certificate
+	c.client = client
+
+	return client, nil
+}
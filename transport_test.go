@@ -2,13 +2,29 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/worldline-go/auth/providers"
+	"github.com/worldline-go/auth/request"
 )
 
 func TestProviderExtra_RoundTripper(t *testing.T) {
@@ -120,3 +136,487 @@ func TestProviderExtra_RoundTripper(t *testing.T) {
 		t.Fatalf("Body = %v, want %v", string(body), "Welcome!")
 	}
 }
+
+func TestProviderExtra_RoundTripperPrivateKeyJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey error = %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	var serverTokenURL string
+	serverToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if _, _, ok := r.BasicAuth(); ok || r.Form.Get("client_secret") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("secret not expected"))
+
+			return
+		}
+
+		if r.Form.Get("client_assertion_type") != request.ClientAssertionTypeJWTBearer {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("client_assertion_type"))
+
+			return
+		}
+
+		claims := jwt.RegisteredClaims{}
+		_, err := jwt.ParseWithClaims(r.Form.Get("client_assertion"), &claims, func(token *jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		}, jwt.WithAudience(serverTokenURL), jwt.WithIssuer("test"), jwt.WithSubject("test"))
+		if err != nil || claims.ID == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("client_assertion invalid"))
+
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"test-token","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer serverToken.Close()
+
+	serverTokenURL = serverToken.URL
+
+	serverDestination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer serverDestination.Close()
+
+	authService := Provider{
+		Generic: &providers.Generic{
+			TokenURL:                serverToken.URL,
+			ClientID:                "test",
+			ClientSecret:            "not-used",
+			TokenEndpointAuthMethod: request.AuthMethodPrivateKeyJWT,
+			ClientAssertionKey:      string(keyPEM),
+		},
+	}
+
+	roundTripper, err := authService.ActiveProvider().RoundTripper(context.Background(), http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("ProviderExtra.RoundTripper() error = %v", err)
+	}
+
+	client := &http.Client{Transport: roundTripper}
+
+	resp, err := client.Get(serverDestination.URL)
+	if err != nil {
+		t.Fatalf("client.Get error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Status code = %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestProviderExtra_ClientPolicy(t *testing.T) {
+	var calls int32
+	serverToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			w.Header().Add("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"test-token","token_type":"bearer","expires_in":3600}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer serverToken.Close()
+
+	authService := Provider{
+		Keycloak: &providers.KeyCloak{
+			TokenURL:     serverToken.URL,
+			ClientID:     "test",
+			ClientSecret: "test-secret",
+		},
+		Client: &request.ClientPolicy{
+			RetryMax:         2,
+			RetryWaitMin:     time.Millisecond,
+			RetryWaitMax:     10 * time.Millisecond,
+			BreakerThreshold: 1,
+			BreakerTimeout:   time.Minute,
+		},
+	}
+
+	p := authService.ActiveProvider().(*ProviderExtra)
+
+	token, err := p.tokenSource(context.Background()).Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	if got := atomic.LoadInt32(&calls); token.AccessToken != "test-token" || got != 3 {
+		t.Fatalf("Token() = %v after %d calls, want test-token after 3 calls", token.AccessToken, got)
+	}
+
+	// bad gateway of the token request is not retried and opens the circuit
+	if _, err := p.tokenSource(context.Background()).Token(); err == nil {
+		t.Fatalf("Token() expected error")
+	}
+
+	callsBefore := atomic.LoadInt32(&calls)
+
+	if _, err := p.tokenSource(context.Background()).Token(); !errors.Is(err, request.ErrCircuitOpen) {
+		t.Fatalf("Token() error = %v, want %v", err, request.ErrCircuitOpen)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != callsBefore {
+		t.Fatalf("server called with open circuit, calls = %d, want %d", got, callsBefore)
+	}
+}
+
+func TestPolicyTransport_Retry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		status, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	policy := &request.ClientPolicy{
+		RetryMax:         2,
+		RetryWaitMin:     time.Millisecond,
+		RetryWaitMax:     10 * time.Millisecond,
+		BreakerThreshold: -1,
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		header    http.Header
+		wantCalls int32
+		wantErr   bool
+	}{
+		{
+			name:      "get server error",
+			method:    http.MethodGet,
+			url:       server.URL + "/500",
+			wantCalls: 3,
+		},
+		{
+			name:      "post server error",
+			method:    http.MethodPost,
+			url:       server.URL + "/500",
+			wantCalls: 1,
+		},
+		{
+			name:      "post idempotency key",
+			method:    http.MethodPost,
+			url:       server.URL + "/500",
+			header:    http.Header{"Idempotency-Key": []string{"1"}},
+			wantCalls: 3,
+		},
+		{
+			name:      "post unavailable",
+			method:    http.MethodPost,
+			url:       server.URL + "/503",
+			wantCalls: 3,
+		},
+		{
+			name:      "post too many requests",
+			method:    http.MethodPost,
+			url:       server.URL + "/429",
+			wantCalls: 3,
+		},
+		{
+			name:    "post connection refused",
+			method:  http.MethodPost,
+			url:     closed.URL,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader("grant_type=client_credentials"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			resp, err := (&http.Client{Transport: policy.Transport(nil)}).Do(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPolicyTransport_BreakerTrial(t *testing.T) {
+	release := map[string]chan struct{}{
+		"/started": make(chan struct{}),
+		"/trial":   make(chan struct{}),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ch, ok := release[r.URL.Path]; ok {
+			<-ch
+		}
+
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: (&request.ClientPolicy{
+			RetryMax:         -1,
+			BreakerThreshold: 1,
+			BreakerTimeout:   20 * time.Millisecond,
+		}).Transport(nil),
+	}
+
+	get := func(path string) error {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			return err
+		}
+
+		return resp.Body.Close()
+	}
+
+	// call started with the closed circuit ends in the half open state
+	errs := make(chan error, 2)
+	go func() { errs <- get("/started") }()
+
+	time.Sleep(10 * time.Millisecond)
+
+	if err := get("/"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	go func() { errs <- get("/trial") }()
+
+	time.Sleep(10 * time.Millisecond)
+
+	close(release["/started"])
+	if err := <-errs; err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if err := get("/"); !errors.Is(err, request.ErrCircuitOpen) {
+		t.Errorf("Get() during trial error = %v, want %v", err, request.ErrCircuitOpen)
+	}
+
+	close(release["/trial"])
+	if err := <-errs; err != nil {
+		t.Fatalf("Get() trial error = %v", err)
+	}
+}
+
+func TestOauth2Transport_InvalidToken(t *testing.T) {
+	var tokenCalls int32
+	serverToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := atomic.AddInt32(&tokenCalls, 1)
+
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, count)
+	}))
+	defer serverToken.Close()
+
+	var apiCalls int32
+	serverAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&apiCalls, 1)
+
+		// first token is revoked
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer serverAPI.Close()
+
+	tests := []struct {
+		name       string
+		body       func() io.Reader
+		wantStatus int
+		wantBody   string
+		wantCalls  int32
+	}{
+		{
+			name:       "replayable body",
+			body:       func() io.Reader { return strings.NewReader("payload") },
+			wantStatus: http.StatusOK,
+			wantBody:   "payload",
+			wantCalls:  2,
+		},
+		{
+			name:       "not replayable body",
+			body:       func() io.Reader { return io.NopCloser(strings.NewReader("payload")) },
+			wantStatus: http.StatusUnauthorized,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&tokenCalls, 0)
+			atomic.StoreInt32(&apiCalls, 0)
+
+			authService := Provider{
+				Keycloak: &providers.KeyCloak{
+					TokenURL:     serverToken.URL,
+					ClientID:     "test",
+					ClientSecret: "test-secret",
+				},
+			}
+
+			transport, err := authService.ActiveProvider().RoundTripper(context.Background(), http.DefaultTransport)
+			if err != nil {
+				t.Fatalf("RoundTripper() error = %v", err)
+			}
+
+			req, _ := http.NewRequest(http.MethodPost, serverAPI.URL, tt.body())
+			resp, err := (&http.Client{Transport: transport}).Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+
+			if got := atomic.LoadInt32(&apiCalls); got != tt.wantCalls {
+				t.Errorf("api calls = %d, want %d", got, tt.wantCalls)
+			}
+
+			// rejected token is invalidated even without the retry
+			next, err := (&http.Client{Transport: transport}).Get(serverAPI.URL)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			next.Body.Close()
+
+			if got := atomic.LoadInt32(&apiCalls); next.StatusCode != http.StatusOK || got != tt.wantCalls+1 {
+				t.Errorf("next status = %d after %d api calls, want %d after %d", next.StatusCode, got, http.StatusOK, tt.wantCalls+1)
+			}
+		})
+	}
+}
+
+func TestProviderExtra_TLSClientAuthCache(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	writeCert := func(t *testing.T, modTime time.Time) {
+		t.Helper()
+
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(modTime.UnixNano()),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for file, block := range map[string]*pem.Block{
+			certFile: {Type: "CERTIFICATE", Bytes: der},
+			keyFile:  {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		} {
+			if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Chtimes(file, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	writeCert(t, time.Now().Add(-time.Minute))
+
+	p := (&Provider{
+		Generic: &providers.Generic{
+			TokenURL:                "https://localhost/token",
+			ClientID:                "test",
+			TokenEndpointAuthMethod: request.AuthMethodTLSClientAuth,
+			TLSClientCertFile:       certFile,
+			TLSClientKeyFile:        keyFile,
+		},
+	}).ActiveProvider().(*ProviderExtra)
+
+	client := func(t *testing.T) *http.Client {
+		t.Helper()
+
+		clientAuth, err := p.ClientAuth()
+		if err != nil {
+			t.Fatalf("ClientAuth() error = %v", err)
+		}
+
+		client, err := p.certClients.HTTPClient(clientAuth, nil)
+		if err != nil {
+			t.Fatalf("HTTPClient() error = %v", err)
+		}
+
+		return client
+	}
+
+	first := client(t)
+	if second := client(t); second != first {
+		t.Fatal("client created again with the same certificate")
+	}
+
+	writeCert(t, time.Now())
+
+	if rotated := client(t); rotated == first {
+		t.Fatal("client not created again after the certificate rotation")
+	}
+}
@@ -0,0 +1,389 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/worldline-go/auth/request"
+	"golang.org/x/oauth2"
+)
+
+// ErrUserTokenNotFound is returned by the UserTokenSource when there is no token to use, user should log in.
+var ErrUserTokenNotFound = errors.New("user token not found")
+
+// UserTokenKeySize is the size of the key of WithUserTokenKey.
+const UserTokenKeySize = 32
+
+// UserTokenSource is a token source of a logged-in user, refreshes the token with the refresh token.
+//
+// Token set is persisted to a file to use across runs, useful for CLIs with password or device grant.
+type UserTokenSource struct {
+	ctx               context.Context
+	authClient        *request.Auth
+	authRequestConfig request.AuthRequestConfig
+	file              string
+	key               []byte
+
+	mutex   sync.Mutex
+	token   *oauth2.Token
+	refresh bool
+}
+
+// userTokenFile is the persisted token set.
+type userTokenFile struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+type optionsUserToken struct {
+	authClient *request.Auth
+	file       string
+	key        []byte
+	token      *oauth2.Token
+}
+
+type OptionUserToken func(*optionsUserToken)
+
+// WithUserTokenFile sets the file to persist the token set, written with 0600 permission.
+func WithUserTokenFile(file string) OptionUserToken {
+	return func(opts *optionsUserToken) {
+		opts.file = file
+	}
+}
+
+// WithUserTokenKey encrypts the file with AES-256-GCM, key must be UserTokenKeySize random bytes.
+//
+// Key is not derived from a password, generate it with crypto/rand and keep it in a secret store like the OS keyring.
+func WithUserTokenKey(key []byte) OptionUserToken {
+	return func(opts *optionsUserToken) {
+		opts.key = key
+	}
+}
+
+// WithUserToken sets the token of the login, it replaces the token in the file.
+func WithUserToken(token *oauth2.Token) OptionUserToken {
+	return func(opts *optionsUserToken) {
+		opts.token = token
+	}
+}
+
+// WithUserTokenAuth sets the request client to refresh the token, default is request.DefaultAuth.
+func WithUserTokenAuth(authClient *request.Auth) OptionUserToken {
+	return func(opts *optionsUserToken) {
+		opts.authClient = authClient
+	}
+}
+
+// NewUserTokenSource returns a token source refreshing with the config, TokenURL and ClientID are required.
+//
+// Token is read from the file if not set with WithUserToken.
+func NewUserTokenSource(ctx context.Context, cfg request.AuthRequestConfig, opts ...OptionUserToken) (*UserTokenSource, error) {
+	var options optionsUserToken
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if options.authClient == nil {
+		options.authClient = request.DefaultAuth
+	}
+
+	s := &UserTokenSource{
+		ctx:               ctx,
+		authClient:        options.authClient,
+		authRequestConfig: cfg,
+		file:              options.file,
+	}
+
+	if options.key != nil {
+		if len(options.key) != UserTokenKeySize {
+			return nil, fmt.Errorf("user token key must be %d bytes", UserTokenKeySize)
+		}
+
+		s.key = append([]byte(nil), options.key...)
+	}
+
+	if options.token != nil {
+		if err := s.SetToken(options.token); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	token, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = token
+
+	return s, nil
+}
+
+// NewUserTokenSource returns a user token source with the provider's token URL and client authentication.
+func (p *ProviderExtra) NewUserTokenSource(ctx context.Context, opts ...OptionUserToken) (*UserTokenSource, error) {
+	// client has the DPoP of the provider to get DPoP bound tokens
+	authClient, cfg, err := p.authRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUserTokenSource(ctx, cfg, append([]OptionUserToken{WithUserTokenAuth(authClient)}, opts...)...)
+}
+
+// NewOauth2SharedUser returns a shared token source of the user, see NewUserTokenSource.
+func (p *ProviderExtra) NewOauth2SharedUser(ctx context.Context, opts ...OptionUserToken) (*OAuth2Shared, error) {
+	source, err := p.NewUserTokenSource(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuth2Shared{
+		Source: source,
+		DPoP:   p.dpop,
+	}, nil
+}
+
+// SetToken replaces the token and persists it to the file.
+func (s *UserTokenSource) SetToken(token *oauth2.Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.save(token); err != nil {
+		return err
+	}
+
+	s.token = token
+	s.refresh = false
+
+	return nil
+}
+
+// Token returns the current token, refreshes it if IsRefreshNeed or the expiry says so.
+func (s *UserTokenSource) Token() (*oauth2.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token == nil {
+		return nil, ErrUserTokenNotFound
+	}
+
+	if !s.refresh && !isUserTokenRefreshNeed(s.token) {
+		return s.token, nil
+	}
+
+	if s.token.RefreshToken == "" {
+		if !s.refresh && s.token.Valid() {
+			return s.token, nil
+		}
+
+		return nil, fmt.Errorf("%w: token expired without refresh token", ErrUserTokenNotFound)
+	}
+
+	cfg := request.RefreshTokenConfig{
+		RefreshToken:      s.token.RefreshToken,
+		AuthRequestConfig: s.authRequestConfig,
+	}
+
+	response, err := request.DecodeToken(s.authClient.RefreshToken(s.ctx, cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	token := response.OAuth2Token()
+	// refresh token rotation is optional
+	if token.RefreshToken == "" {
+		token.RefreshToken = s.token.RefreshToken
+	}
+
+	if response.IDToken == "" {
+		if idToken, ok := s.token.Extra("id_token").(string); ok && idToken != "" {
+			token = token.WithExtra(map[string]interface{}{"id_token": idToken})
+		}
+	}
+
+	if err := s.save(token); err != nil {
+		return nil, err
+	}
+
+	s.token = token
+	s.refresh = false
+
+	return token, nil
+}
+
+// Invalidate refreshes the token in the next Token call if it is still the given token.
+func (s *UserTokenSource) Invalidate(token *oauth2.Token) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token != nil && token != nil && s.token.AccessToken == token.AccessToken {
+		s.refresh = true
+	}
+}
+
+// isUserTokenRefreshNeed checks the JWT expiration, non JWT tokens use the expiry of the response.
+func isUserTokenRefreshNeed(token *oauth2.Token) bool {
+	if v, err := IsRefreshNeed(token.AccessToken); err == nil {
+		return v
+	}
+
+	if token.Expiry.IsZero() {
+		return false
+	}
+
+	return token.Expiry.Before(time.Now().Add(DefaultExpireDuration))
+}
+
+func (s *UserTokenSource) load() (*oauth2.Token, error) {
+	if s.file == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	if s.key != nil {
+		data, err = s.decrypt(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var v userTokenFile
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse token file: %w", err)
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  v.AccessToken,
+		TokenType:    v.TokenType,
+		RefreshToken: v.RefreshToken,
+		Expiry:       v.Expiry,
+	}
+
+	if v.IDToken != "" {
+		token = token.WithExtra(map[string]interface{}{"id_token": v.IDToken})
+	}
+
+	return token, nil
+}
+
+func (s *UserTokenSource) save(token *oauth2.Token) error {
+	if s.file == "" {
+		return nil
+	}
+
+	v := userTokenFile{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	}
+	v.IDToken, _ = token.Extra("id_token").(string)
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if s.key != nil {
+		data, err = s.encrypt(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	// write to a temp file and rename to not leave a partial file
+	f, err := os.CreateTemp(filepath.Dir(s.file), "."+filepath.Base(s.file)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create token file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+
+		return fmt.Errorf("failed to set token file permission: %w", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), s.file); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *UserTokenSource) encrypt(data []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func (s *UserTokenSource) decrypt(data []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("failed to decrypt token file: invalid size")
+	}
+
+	v, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt token file: %w", err)
+	}
+
+	return v, nil
+}
+
+func (s *UserTokenSource) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
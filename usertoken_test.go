@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/worldline-go/auth/providers"
+	"golang.org/x/oauth2"
+)
+
+func TestUserTokenSource(t *testing.T) {
+	newToken := func(t *testing.T, name string, exp time.Duration) string {
+		t.Helper()
+
+		v, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"name": name,
+			"exp":  time.Now().Add(exp).Unix(),
+		}).SignedString([]byte("test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	var refreshes int32
+	serverToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		count := atomic.AddInt32(&refreshes, 1)
+
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":%q,"token_type":"bearer","expires_in":3600}`, newToken(t, fmt.Sprintf("refreshed-%d", count), time.Hour))
+	}))
+	defer serverToken.Close()
+
+	authService := Provider{
+		Keycloak: &providers.KeyCloak{
+			TokenURL: serverToken.URL,
+			ClientID: "cli",
+		},
+	}
+
+	file := filepath.Join(t.TempDir(), "token.json")
+	key := make([]byte, UserTokenKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	expired := newToken(t, "expired", time.Second)
+
+	shared, err := authService.ActiveProvider().NewOauth2SharedUser(context.Background(),
+		WithUserTokenFile(file),
+		WithUserTokenKey(key),
+		WithUserToken(&oauth2.Token{AccessToken: expired, RefreshToken: "refresh"}),
+	)
+	if err != nil {
+		t.Fatalf("NewOauth2SharedUser() error = %v", err)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("token file not written: %v", err)
+	}
+
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("token file permission = %v, want 0600", info.Mode().Perm())
+	}
+
+	if data, _ := os.ReadFile(file); strings.Contains(string(data), "refresh") {
+		t.Errorf("token file is not encrypted")
+	}
+
+	serverAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer serverAPI.Close()
+
+	transport, err := shared.RoundTripper(context.Background(), http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("RoundTripper() error = %v", err)
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Get(serverAPI.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if got := atomic.LoadInt32(&refreshes); got != 1 || string(body) == "Bearer "+expired {
+		t.Fatalf("token not refreshed, refreshes = %d", got)
+	}
+
+	// next run reads the refreshed token from the file
+	source, err := authService.ActiveProvider().(*ProviderExtra).NewUserTokenSource(context.Background(),
+		WithUserTokenFile(file),
+		WithUserTokenKey(key),
+	)
+	if err != nil {
+		t.Fatalf("NewUserTokenSource() error = %v", err)
+	}
+
+	token, err := source.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	if "Bearer "+token.AccessToken != string(body) || token.RefreshToken != "refresh" || atomic.LoadInt32(&refreshes) != 1 {
+		t.Errorf("Token() = %v, want the persisted token", token.AccessToken)
+	}
+
+	if _, err := NewUserTokenSource(context.Background(), source.authRequestConfig,
+		WithUserTokenFile(file),
+		WithUserTokenKey(make([]byte, UserTokenKeySize)),
+	); err == nil {
+		t.Errorf("NewUserTokenSource() expected decrypt error")
+	}
+
+	if _, err := NewUserTokenSource(context.Background(), source.authRequestConfig,
+		WithUserTokenFile(file),
+		WithUserTokenKey([]byte("local-password")),
+	); err == nil {
+		t.Errorf("NewUserTokenSource() expected key size error")
+	}
+
+	empty, err := NewUserTokenSource(context.Background(), source.authRequestConfig,
+		WithUserTokenFile(filepath.Join(t.TempDir(), "missing.json")),
+	)
+	if err != nil {
+		t.Fatalf("NewUserTokenSource() error = %v", err)
+	}
+
+	if _, err := empty.Token(); !errors.Is(err, ErrUserTokenNotFound) {
+		t.Errorf("Token() error = %v, want %v", err, ErrUserTokenNotFound)
+	}
+}